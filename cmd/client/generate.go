@@ -0,0 +1,129 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+)
+
+// generatorOpts are the flags of commands generating files from a config
+// struct, each command has its own, as flags write their defaults to them
+type generatorOpts struct {
+	Package   string
+	Type      string
+	Format    string
+	ENVPrefix string
+	Output    string
+}
+
+// generatorTemplate is a program calling a markup generator with the config
+// struct of a package in the current module
+var generatorTemplate = template.Must(template.New("generator").Parse(`package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bhojpur/configure/pkg/markup"
+	config {{ printf "%q" .Package }}
+)
+
+func main() {
+	configure := markup.New(&markup.Config{ENVPrefix: {{ printf "%q" .ENVPrefix }}})
+	if err := configure.{{ .Function }}(os.Stdout, &config.{{ .Type }}{}, {{ printf "%q" .Format }}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+`))
+
+// runGenerator builds and runs a temporary program within the current module,
+// that calls markup's function with the config struct set by opts, as config
+// structs can only be inspected from within their own program
+func runGenerator(function string, opts *generatorOpts) error {
+	if opts.Package == "" || opts.Type == "" {
+		return fmt.Errorf("--package and --type are required")
+	}
+
+	pkg, err := exec.Command("go", "list", "-f", "{{.ImportPath}}", opts.Package).Output()
+	if err != nil {
+		return fmt.Errorf("cannot find package %s: %w", opts.Package, err)
+	}
+
+	dir, err := ioutil.TempDir(".", ".configctl-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	var source bytes.Buffer
+	if err := generatorTemplate.Execute(&source, map[string]string{
+		"Package":   strings.TrimSpace(string(pkg)),
+		"Type":      opts.Type,
+		"Format":    opts.Format,
+		"ENVPrefix": opts.ENVPrefix,
+		"Function":  function,
+	}); err != nil {
+		return err
+	}
+
+	file := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(file, source.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	output := os.Stdout
+	if opts.Output != "" {
+		if output, err = os.Create(opts.Output); err != nil {
+			return err
+		}
+		defer output.Close()
+	}
+
+	cmd := exec.Command("go", "run", file)
+	cmd.Stdout = output
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// addGeneratorFlags adds the flags selecting the config struct to cmd, with
+// format as the default format
+func addGeneratorFlags(cmd *cobra.Command, opts *generatorOpts, format string) {
+	envPrefix := os.Getenv("CONFIGURE_ENV_PREFIX")
+	if envPrefix == "" {
+		envPrefix = "bhojpur"
+	}
+
+	cmd.Flags().StringVar(&opts.Package, "package", "", "package of the config struct, as import path or directory in the current module")
+	cmd.Flags().StringVar(&opts.Type, "type", "", "name of the config struct")
+	cmd.Flags().StringVar(&opts.Format, "format", format, "format of the output")
+	cmd.Flags().StringVar(&opts.ENVPrefix, "env-prefix", envPrefix, "prefix of env variables (defaults to CONFIGURE_ENV_PREFIX env var)")
+	cmd.Flags().StringVarP(&opts.Output, "output", "o", "", "file to write to, instead of stdout")
+}
@@ -0,0 +1,145 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/bhojpur/configure/pkg/markup"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var secretCmdOpts struct {
+	Keyfile string
+}
+
+// secretCmd represents the secret command
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Encrypts, decrypts and rotates values in configuration files",
+}
+
+// secretEncryptCmd represents the secret encrypt command
+var secretEncryptCmd = &cobra.Command{
+	Use:   "encrypt [value]",
+	Short: "Encrypts a value with the first key, reads the value from stdin if omitted",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		value, err := getSecretValue(args)
+		if err != nil {
+			log.WithError(err).Fatal("cannot read value")
+		}
+
+		envelope, err := markup.EncryptValue(getKeyProvider(), value)
+		if err != nil {
+			log.WithError(err).Fatal("cannot encrypt value")
+		}
+		fmt.Println(envelope)
+	},
+}
+
+// secretDecryptCmd represents the secret decrypt command
+var secretDecryptCmd = &cobra.Command{
+	Use:   "decrypt [envelope]",
+	Short: "Decrypts an encrypted value, reads the value from stdin if omitted",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		envelope, err := getSecretValue(args)
+		if err != nil {
+			log.WithError(err).Fatal("cannot read value")
+		}
+
+		value, err := markup.DecryptValue(getKeyProvider(), strings.TrimSpace(envelope))
+		if err != nil {
+			log.WithError(err).Fatal("cannot decrypt value")
+		}
+		fmt.Println(value)
+	},
+}
+
+// secretRotateCmd represents the secret rotate command
+var secretRotateCmd = &cobra.Command{
+	Use:   "rotate <file>...",
+	Short: "Re-encrypts every value of configuration files with the first key, in place",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		provider := getKeyProvider()
+		for _, file := range args {
+			info, err := os.Stat(file)
+			if err != nil {
+				log.WithError(err).Fatalf("cannot read %s", file)
+			}
+
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				log.WithError(err).Fatalf("cannot read %s", file)
+			}
+
+			if data, err = markup.RotateValues(provider, data); err != nil {
+				log.WithError(err).Fatalf("cannot rotate values of %s", file)
+			}
+
+			if err := ioutil.WriteFile(file, data, info.Mode()); err != nil {
+				log.WithError(err).Fatalf("cannot write %s", file)
+			}
+			log.Debugf("rotated values of %s", file)
+		}
+	},
+}
+
+func getSecretValue(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+
+	data, err := ioutil.ReadAll(os.Stdin)
+	return strings.TrimSuffix(string(data), "\n"), err
+}
+
+func getKeyProvider() markup.KeyProvider {
+	var (
+		provider markup.KeyProvider
+		err      error
+	)
+
+	if secretCmdOpts.Keyfile != "" {
+		provider, err = markup.LoadKeyFile(secretCmdOpts.Keyfile)
+	} else {
+		provider, err = markup.DefaultKeyProvider()
+	}
+
+	if err != nil {
+		log.WithError(err).Fatal("cannot load keys")
+	}
+	return provider
+}
+
+func init() {
+	secretCmd.PersistentFlags().StringVar(&secretCmdOpts.Keyfile, "keyfile", "", "file holding <id>:<base64 key> lines, the first key encrypts values (defaults to CONFIGURE_SECRET_KEYS or CONFIGURE_SECRET_KEYFILE env vars)")
+	secretCmd.AddCommand(secretEncryptCmd)
+	secretCmd.AddCommand(secretDecryptCmd)
+	secretCmd.AddCommand(secretRotateCmd)
+	rootCmd.AddCommand(secretCmd)
+}
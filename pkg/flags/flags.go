@@ -0,0 +1,313 @@
+package flags
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bhojpur/configure/pkg/markup"
+)
+
+// Reasons of evaluations
+const (
+	ReasonUnknown  = "unknown"
+	ReasonOverride = "override"
+	ReasonDisabled = "disabled"
+	ReasonRule     = "rule"
+	ReasonRollout  = "rollout"
+	ReasonDefault  = "default"
+)
+
+// Definition defines a feature flag in configuration files, e.g.
+//
+//	flags:
+//	  new-checkout:
+//	    enabled: true
+//	    rollout: 25
+//	    rules:
+//	    - attribute: country
+//	      values: [IN]
+type Definition struct {
+	Description string `yaml:"description" json:"description,omitempty"`
+	// Enabled turns the flag on, disabled flags are off for every subject
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Rollout is the percentage of subjects the flag is on for, the flag is on
+	// for every subject if it is nil
+	Rollout *float64 `yaml:"rollout" json:"rollout,omitempty"`
+	// Rules target subjects by their attributes, the first matching rule
+	// decides whether the flag is on
+	Rules []Rule `yaml:"rules" json:"rules,omitempty"`
+}
+
+// Rule targets subjects whose attribute is one of Values with the operator
+// `in`, the default one, or is not one of them with the operator `not_in`
+type Rule struct {
+	Attribute string   `yaml:"attribute" json:"attribute"`
+	Operator  string   `yaml:"operator" json:"operator,omitempty"`
+	Values    []string `yaml:"values" json:"values"`
+	// Enabled is whether the flag is on for matching subjects, it is on if
+	// Enabled is nil
+	Enabled *bool `yaml:"enabled" json:"enabled,omitempty"`
+	// Rollout is the percentage of matching subjects the flag is on for
+	Rollout *float64 `yaml:"rollout" json:"rollout,omitempty"`
+}
+
+// matches reports whether subject matches the rule
+func (rule Rule) matches(subject Subject) bool {
+	value, ok := subject.Attributes[rule.Attribute]
+	var found bool
+	for _, v := range rule.Values {
+		found = found || (ok && v == value)
+	}
+
+	if rule.Operator == "not_in" {
+		return !found
+	}
+	return found
+}
+
+// Subject is who flags are evaluated for, Key identifies it in rollouts, e.g.
+// a user id, so that it gets the same result in every evaluation
+type Subject struct {
+	Key        string
+	Attributes map[string]string
+}
+
+// Evaluation is the result of the evaluation of a flag
+type Evaluation struct {
+	Flag    string
+	Enabled bool
+	// Reason tells why the flag is on or off, e.g. `rule` or `rollout`
+	Reason string
+	// Rule is the index of the matching rule if Reason is `rule`
+	Rule int
+}
+
+// Stats counts the evaluations of a flag
+type Stats struct {
+	Evaluations uint64 `json:"evaluations"`
+	Enabled     uint64 `json:"enabled"`
+}
+
+type flagStats struct {
+	evaluations uint64
+	enabled     uint64
+}
+
+// flagsConfig is the configuration flags are loaded from
+type flagsConfig struct {
+	Flags map[string]Definition `yaml:"flags" json:"flags"`
+}
+
+// Flags evaluates feature flags defined in configuration files
+type Flags struct {
+	configure *markup.Configure
+
+	mutex       sync.RWMutex
+	subscribe   sync.Once
+	definitions map[string]Definition
+	overrides   map[string]bool
+	stats       map[string]*flagStats
+}
+
+// New initialize Flags, loading definitions with markup's config, they are
+// reloaded in auto reload mode
+func New(config *markup.Config) *Flags {
+	return &Flags{
+		configure: markup.New(config),
+		overrides: map[string]bool{},
+		stats:     map[string]*flagStats{},
+	}
+}
+
+// Load loads flag definitions from files
+func (flags *Flags) Load(files ...string) error {
+	flags.subscribe.Do(func() {
+		flags.configure.OnChange("", func(event markup.ChangeEvent) {
+			if config, ok := event.New.(*flagsConfig); ok {
+				flags.mutex.Lock()
+				flags.definitions = config.Flags
+				flags.mutex.Unlock()
+			}
+		})
+	})
+
+	var config flagsConfig
+	if err := flags.configure.Load(&config, files...); err != nil {
+		return err
+	}
+
+	flags.mutex.Lock()
+	flags.definitions = config.Flags
+	flags.mutex.Unlock()
+	return nil
+}
+
+// Load loads flag definitions from files, see Flags.Load
+func Load(files ...string) (*Flags, error) {
+	flags := New(nil)
+	return flags, flags.Load(files...)
+}
+
+// IsEnabled reports whether the flag is on for subject
+func (flags *Flags) IsEnabled(flag string, subject Subject) bool {
+	return flags.Evaluate(flag, subject).Enabled
+}
+
+// Evaluate evaluates the flag for subject: overrides set with Override win,
+// disabled flags are off, then the first rule matching subject decides, then
+// the rollout. Evaluations are deterministic, a subject gets the same result
+// as long as the definition of the flag is the same. Stats are counted only
+// for flags defined in files, so that unknown names don't grow them
+func (flags *Flags) Evaluate(flag string, subject Subject) Evaluation {
+	evaluation := flags.evaluate(flag, subject)
+
+	flags.mutex.RLock()
+	_, defined := flags.definitions[flag]
+	stats, ok := flags.stats[flag]
+	flags.mutex.RUnlock()
+
+	if !defined {
+		return evaluation
+	}
+
+	if !ok {
+		// take the write lock only for the first evaluation of the flag
+		flags.mutex.Lock()
+		if stats, ok = flags.stats[flag]; !ok {
+			stats = &flagStats{}
+			flags.stats[flag] = stats
+		}
+		flags.mutex.Unlock()
+	}
+
+	atomic.AddUint64(&stats.evaluations, 1)
+	if evaluation.Enabled {
+		atomic.AddUint64(&stats.enabled, 1)
+	}
+	return evaluation
+}
+
+func (flags *Flags) evaluate(flag string, subject Subject) Evaluation {
+	flags.mutex.RLock()
+	definition, ok := flags.definitions[flag]
+	override, overridden := flags.overrides[flag]
+	flags.mutex.RUnlock()
+
+	switch {
+	case overridden:
+		return Evaluation{Flag: flag, Enabled: override, Reason: ReasonOverride}
+	case !ok:
+		return Evaluation{Flag: flag, Reason: ReasonUnknown}
+	case !definition.Enabled:
+		return Evaluation{Flag: flag, Reason: ReasonDisabled}
+	}
+
+	for idx, rule := range definition.Rules {
+		if rule.matches(subject) {
+			enabled := (rule.Enabled == nil || *rule.Enabled) && inRollout(flag, subject, rule.Rollout)
+			return Evaluation{Flag: flag, Enabled: enabled, Reason: ReasonRule, Rule: idx}
+		}
+	}
+
+	if definition.Rollout != nil {
+		return Evaluation{Flag: flag, Enabled: inRollout(flag, subject, definition.Rollout), Reason: ReasonRollout}
+	}
+	return Evaluation{Flag: flag, Enabled: true, Reason: ReasonDefault}
+}
+
+// inRollout reports whether subject is in the rollout percentage of flag, by
+// hashing the flag with the key of subject into one of 10000 buckets
+func inRollout(flag string, subject Subject, rollout *float64) bool {
+	if rollout == nil {
+		return true
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(flag + "/" + subject.Key))
+	return float64(hash.Sum32()%10000) < *rollout*100
+}
+
+// Override forces the flag on or off for every subject until it is removed
+// with RemoveOverride, over its definition
+func (flags *Flags) Override(flag string, enabled bool) {
+	flags.mutex.Lock()
+	defer flags.mutex.Unlock()
+	flags.overrides[flag] = enabled
+}
+
+// RemoveOverride removes the override of the flag set with Override
+func (flags *Flags) RemoveOverride(flag string) {
+	flags.mutex.Lock()
+	defer flags.mutex.Unlock()
+	delete(flags.overrides, flag)
+}
+
+// Definitions returns the loaded definitions of flags, by their names
+func (flags *Flags) Definitions() map[string]Definition {
+	flags.mutex.RLock()
+	defer flags.mutex.RUnlock()
+
+	results := map[string]Definition{}
+	for name, definition := range flags.definitions {
+		results[name] = definition
+	}
+	return results
+}
+
+// Stats returns the evaluation stats of flags, by their names
+func (flags *Flags) Stats() map[string]Stats {
+	flags.mutex.RLock()
+	defer flags.mutex.RUnlock()
+
+	results := map[string]Stats{}
+	for name, stats := range flags.stats {
+		results[name] = Stats{Evaluations: atomic.LoadUint64(&stats.evaluations), Enabled: atomic.LoadUint64(&stats.enabled)}
+	}
+	return results
+}
+
+// names returns the names of defined, overridden or evaluated flags in order
+func (flags *Flags) names() []string {
+	flags.mutex.RLock()
+	defer flags.mutex.RUnlock()
+
+	set := map[string]bool{}
+	for name := range flags.definitions {
+		set[name] = true
+	}
+	for name := range flags.overrides {
+		set[name] = true
+	}
+	for name := range flags.stats {
+		set[name] = true
+	}
+
+	var names []string
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,232 @@
+package flags
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/configure/pkg/markup"
+)
+
+const testFlags = `flags:
+  dark-mode:
+    enabled: true
+  checkout:
+    enabled: false
+  search:
+    enabled: true
+    rollout: 25
+    rules:
+    - attribute: country
+      values: [IN]
+    - attribute: plan
+      operator: not_in
+      values: [free, trial]
+      enabled: false
+`
+
+func writeFlags(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("/tmp", "flags.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(content)
+	file.Close()
+	return file.Name()
+}
+
+func TestEvaluate(t *testing.T) {
+	file := writeFlags(t, testFlags)
+	defer os.Remove(file)
+
+	flags := New(&markup.Config{ENVPrefix: "FLAGS1"})
+	if err := flags.Load(file); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		flag    string
+		subject Subject
+		enabled bool
+		reason  string
+	}{
+		{"dark-mode", Subject{Key: "1"}, true, ReasonDefault},
+		{"checkout", Subject{Key: "1"}, false, ReasonDisabled},
+		{"unknown", Subject{Key: "1"}, false, ReasonUnknown},
+		{"search", Subject{Key: "1", Attributes: map[string]string{"country": "IN"}}, true, ReasonRule},
+		{"search", Subject{Key: "1", Attributes: map[string]string{"plan": "pro"}}, false, ReasonRule},
+	} {
+		if evaluation := flags.Evaluate(test.flag, test.subject); evaluation.Enabled != test.enabled || evaluation.Reason != test.reason {
+			t.Errorf("%v should be %v by %v for %+v, but got %+v", test.flag, test.enabled, test.reason, test.subject, evaluation)
+		}
+	}
+
+	var enabled int
+	for i := 0; i < 10000; i++ {
+		subject := Subject{Key: fmt.Sprint(i), Attributes: map[string]string{"plan": "free"}}
+		if flags.IsEnabled("search", subject) {
+			enabled++
+		}
+		if flags.IsEnabled("search", subject) != flags.IsEnabled("search", subject) {
+			t.Errorf("evaluations should be deterministic for %v", subject.Key)
+		}
+	}
+
+	if enabled < 2300 || enabled > 2700 {
+		t.Errorf("search should be on for about 25%% of subjects, but got %v", enabled)
+	}
+
+	if stats := flags.Stats()["search"]; stats.Evaluations != 30002 || stats.Enabled < uint64(enabled) {
+		t.Errorf("stats should count evaluations, but got %+v", stats)
+	}
+
+	flags.Override("checkout", true)
+	if evaluation := flags.Evaluate("checkout", Subject{}); !evaluation.Enabled || evaluation.Reason != ReasonOverride {
+		t.Errorf("overrides should win over definitions, but got %+v", evaluation)
+	}
+
+	flags.RemoveOverride("checkout")
+	if flags.IsEnabled("checkout", Subject{}) {
+		t.Errorf("checkout should be off after removing its override")
+	}
+}
+
+func TestReload(t *testing.T) {
+	file := writeFlags(t, testFlags)
+	defer os.Remove(file)
+
+	flags := New(&markup.Config{ENVPrefix: "FLAGS2", AutoReload: true, AutoReloadInterval: 10 * time.Millisecond})
+	if err := flags.Load(file); err != nil {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(file, []byte(strings.Replace(testFlags, "enabled: false\n  search", "enabled: true\n  search", 1)), 0644)
+	os.Chtimes(file, time.Now().Add(time.Second), time.Now().Add(time.Second))
+
+	for i := 0; i < 100 && !flags.IsEnabled("checkout", Subject{}); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !flags.IsEnabled("checkout", Subject{}) {
+		t.Errorf("definitions should be reloaded")
+	}
+}
+
+func TestReloadRemovedFlags(t *testing.T) {
+	file := writeFlags(t, testFlags)
+	defer os.Remove(file)
+
+	flags := New(&markup.Config{ENVPrefix: "FLAGS4", AutoReload: true, AutoReloadInterval: 10 * time.Millisecond})
+	if err := flags.Load(file); err != nil {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(file, []byte(strings.Replace(testFlags, "  dark-mode:\n    enabled: true\n", "", 1)), 0644)
+	os.Chtimes(file, time.Now().Add(time.Second), time.Now().Add(time.Second))
+
+	for i := 0; i < 100 && flags.IsEnabled("dark-mode", Subject{}); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if evaluation := flags.Evaluate("dark-mode", Subject{}); evaluation.Enabled || evaluation.Reason != ReasonUnknown {
+		t.Errorf("flags removed from files should be unknown after reload, but got %+v", evaluation)
+	}
+
+	if _, ok := flags.Definitions()["search"]; !ok {
+		t.Errorf("other flags should be kept after reload")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	file := writeFlags(t, testFlags)
+	defer os.Remove(file)
+
+	flags := New(&markup.Config{ENVPrefix: "FLAGS3"})
+	if err := flags.Load(file); err != nil {
+		t.Fatal(err)
+	}
+	handler := flags.Handler()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("PUT", "/checkout", strings.NewReader(`{"enabled": true}`)))
+	if recorder.Code != 200 || !flags.IsEnabled("checkout", Subject{}) {
+		t.Errorf("handler should override flags, but got %v %v", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if body := recorder.Body.String(); !strings.Contains(body, `"name":"checkout","definition":{"enabled":false},"override":true,"stats":{"evaluations":1,"enabled":1}`) || !strings.Contains(body, `"name":"search"`) {
+		t.Errorf("handler should list flags, but got %v", body)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("DELETE", "/checkout", nil))
+	if recorder.Code != 200 || flags.IsEnabled("checkout", Subject{}) {
+		t.Errorf("handler should remove overrides, but got %v %v", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("PUT", "/checkout", strings.NewReader(`{}`)))
+	if recorder.Code != 400 {
+		t.Errorf("handler should reject invalid bodies, but got %v", recorder.Code)
+	}
+}
+
+func TestStatsOfUnknownFlags(t *testing.T) {
+	file := writeFlags(t, testFlags)
+	defer os.Remove(file)
+
+	flags := New(&markup.Config{ENVPrefix: "FLAGS5"})
+	if err := flags.Load(file); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		flags.Evaluate(fmt.Sprintf("unknown-%v", i), Subject{})
+	}
+	flags.Evaluate("dark-mode", Subject{})
+
+	if stats := flags.Stats(); len(stats) != 1 || stats["dark-mode"].Evaluations != 1 {
+		t.Errorf("stats should be counted only for defined flags, but got %+v", stats)
+	}
+}
+
+func TestHandlerWithoutFlags(t *testing.T) {
+	file := writeFlags(t, "flags: {}\n")
+	defer os.Remove(file)
+
+	flags := New(&markup.Config{ENVPrefix: "FLAGS6"})
+	if err := flags.Load(file); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	flags.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if body := strings.TrimSpace(recorder.Body.String()); body != "[]" {
+		t.Errorf("handler should list no flags as an empty list, but got %v", body)
+	}
+}
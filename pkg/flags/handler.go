@@ -0,0 +1,100 @@
+package flags
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// flagStatus is a flag listed by the admin handler
+type flagStatus struct {
+	Name       string      `json:"name"`
+	Definition *Definition `json:"definition,omitempty"`
+	Override   *bool       `json:"override,omitempty"`
+	Stats      Stats       `json:"stats"`
+}
+
+// Handler returns a http.Handler to administrate flags, relative to the path
+// it is mounted on:
+//
+//	GET    /              lists flags with their definitions, overrides and stats
+//	GET    /{flag}        shows a flag
+//	PUT    /{flag}        overrides a flag with a body like {"enabled": true}
+//	DELETE /{flag}        removes the override of a flag
+//
+// Mount it with http.StripPrefix, e.g.
+// `http.Handle("/flags/", http.StripPrefix("/flags", flags.Handler()))`
+func (flags *Flags) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := strings.Trim(req.URL.Path, "/")
+
+		switch {
+		case name == "" && req.Method == http.MethodGet:
+			results := []flagStatus{}
+			for _, name := range flags.names() {
+				results = append(results, flags.status(name))
+			}
+			writeJSON(w, http.StatusOK, results)
+		case name == "":
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		case req.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, flags.status(name))
+		case req.Method == http.MethodPut || req.Method == http.MethodPost:
+			var body struct {
+				Enabled *bool `json:"enabled"`
+			}
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Enabled == nil {
+				http.Error(w, `body should be like {"enabled": true}`, http.StatusBadRequest)
+				return
+			}
+			flags.Override(name, *body.Enabled)
+			writeJSON(w, http.StatusOK, flags.status(name))
+		case req.Method == http.MethodDelete:
+			flags.RemoveOverride(name)
+			writeJSON(w, http.StatusOK, flags.status(name))
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (flags *Flags) status(name string) flagStatus {
+	status := flagStatus{Name: name, Stats: flags.Stats()[name]}
+
+	flags.mutex.RLock()
+	defer flags.mutex.RUnlock()
+
+	if definition, ok := flags.definitions[name]; ok {
+		status.Definition = &definition
+	}
+	if override, ok := flags.overrides[name]; ok {
+		status.Override = &override
+	}
+	return status
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
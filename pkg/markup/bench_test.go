@@ -0,0 +1,123 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type benchmarkConfig struct {
+	APPName string        `default:"bench"`
+	Debug   bool          `aliases:"verbose"`
+	Timeout time.Duration `default:"5s"`
+	DB      struct {
+		Name     string `default:"bench"`
+		User     string `required:"true"`
+		Password string `secret:"true"`
+		Port     uint   `default:"3306"`
+	}
+	Services []struct {
+		Name   string `required:"true"`
+		Host   string `default:"localhost"`
+		Port   int    `default:"80"`
+		Tags   []string
+		Limits struct {
+			CPU    float64 `default:"0.5"`
+			Memory string  `default:"128Mi"`
+		}
+		Backup *struct {
+			Schedule string `default:"daily"`
+		}
+	}
+}
+
+func writeBenchmarkConfig(b *testing.B) string {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+
+	var buffer strings.Builder
+	buffer.WriteString("appname: bench\ndb:\n  user: bench\nservices:\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&buffer, "  - name: service%v\n    port: %v\n    tags: [a, b]\n", i, 8000+i)
+	}
+	file.WriteString(buffer.String())
+	return file.Name()
+}
+
+func BenchmarkLoad(b *testing.B) {
+	file := writeBenchmarkConfig(b)
+	defer os.Remove(file)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var config benchmarkConfig
+		if err := New(&Config{ENVPrefix: "BENCH", Silent: true}).Load(&config, file); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProcessDefaults(b *testing.B) {
+	file := writeBenchmarkConfig(b)
+	defer os.Remove(file)
+
+	var loaded benchmarkConfig
+	configure := New(&Config{ENVPrefix: "BENCH", Silent: true})
+	if err := configure.Load(&loaded, file); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		config := loaded
+		if err := configure.processDefaults(&config); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProcessTags(b *testing.B) {
+	file := writeBenchmarkConfig(b)
+	defer os.Remove(file)
+
+	var loaded benchmarkConfig
+	configure := New(&Config{ENVPrefix: "BENCH", Silent: true})
+	if err := configure.Load(&loaded, file); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		config := loaded
+		if err := configure.processTags(&config, "BENCH"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package configtest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/configure/pkg/markup"
+)
+
+// Environment is the fixed environment name of configurations created by New
+const Environment = "test"
+
+// Env is an isolated markup.ENVSource, env variables of the process are not
+// read
+type Env map[string]string
+
+// LookupEnv returns the value of the env variable key
+func (env Env) LookupEnv(key string) (string, bool) {
+	value, ok := env[key]
+	return value, ok
+}
+
+// Environ returns env variables as `key=value`, in order
+func (env Env) Environ() []string {
+	var results []string
+	for key, value := range env {
+		results = append(results, key+"="+value)
+	}
+	sort.Strings(results)
+	return results
+}
+
+// Files is an in-memory markup.FileSystem keyed by file name, files of the
+// process are not read. It is safe for concurrent use
+type Files struct {
+	mutex   sync.RWMutex
+	files   map[string]*file
+	modTime time.Time
+}
+
+type file struct {
+	name    string
+	content []byte
+	modTime time.Time
+}
+
+func (f *file) Name() string       { return f.name }
+func (f *file) Size() int64        { return int64(len(f.content)) }
+func (f *file) Mode() os.FileMode  { return 0644 }
+func (f *file) ModTime() time.Time { return f.modTime }
+func (f *file) IsDir() bool        { return false }
+func (f *file) Sys() interface{}   { return nil }
+
+// NewFiles returns Files holding files, keyed by their names
+func NewFiles(files map[string]string) *Files {
+	result := &Files{files: map[string]*file{}, modTime: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}
+	for name, content := range files {
+		result.Set(name, content)
+	}
+	return result
+}
+
+// Set writes the file name, its modification time is later than the ones of
+// previous writes, so that auto reload mode detects the change
+func (files *Files) Set(name, content string) {
+	files.mutex.Lock()
+	defer files.mutex.Unlock()
+
+	files.modTime = files.modTime.Add(time.Second)
+	files.files[name] = &file{name: name, content: []byte(content), modTime: files.modTime}
+}
+
+// Remove removes the file name
+func (files *Files) Remove(name string) {
+	files.mutex.Lock()
+	defer files.mutex.Unlock()
+	delete(files.files, name)
+}
+
+// Stat returns the os.FileInfo of the file name
+func (files *Files) Stat(name string) (os.FileInfo, error) {
+	files.mutex.RLock()
+	defer files.mutex.RUnlock()
+
+	if f, ok := files.files[name]; ok {
+		return f, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+// ReadFile returns the content of the file name
+func (files *Files) ReadFile(name string) ([]byte, error) {
+	files.mutex.RLock()
+	defer files.mutex.RUnlock()
+
+	if f, ok := files.files[name]; ok {
+		return append([]byte{}, f.content...), nil
+	}
+	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+}
+
+// WriteFile writes the file name like Set, so that markup.Configure.Save
+// writes files in memory
+func (files *Files) WriteFile(name string, data []byte, perm os.FileMode) error {
+	files.Set(name, string(data))
+	return nil
+}
+
+// Config returns a markup.Config reading env variables from env and files
+// from files, with the environment Environment. Events are not logged
+func Config(env Env, files *Files) *markup.Config {
+	if env == nil {
+		env = Env{}
+	}
+	if files == nil {
+		files = NewFiles(nil)
+	}
+
+	return &markup.Config{
+		Environment: Environment,
+		ENVSource:   env,
+		FileSystem:  files,
+		Logger:      markup.LoggerFunc(func(markup.Level, string, markup.Fields) {}),
+	}
+}
+
+// New returns a markup.Configure created with Config(env, files)
+func New(env Env, files *Files) *markup.Configure {
+	return markup.New(Config(env, files))
+}
+
+// AssertSource fails t unless the value of the field at path has been loaded
+// from source, e.g. `default`, `env` or `file:config.yml`
+func AssertSource(t testing.TB, configure *markup.Configure, path, source string) {
+	t.Helper()
+	if got := configure.GetSource(path); got != source {
+		t.Errorf("source of %v should be %v, but got %v", path, source, got)
+	}
+}
+
+// AssertRequired fails t unless err reports that the field is required, but
+// blank
+func AssertRequired(t testing.TB, err error, field string) {
+	t.Helper()
+
+	var requiredError *markup.RequiredError
+	if !errors.As(err, &requiredError) || requiredError.Field != field {
+		t.Errorf("%v should be required, but got %v", field, err)
+	}
+}
+
+// AssertError fails t unless err contains message
+func AssertError(t testing.TB, err error, message string) {
+	t.Helper()
+	if err == nil || !strings.Contains(err.Error(), message) {
+		t.Errorf("error should contain %q, but got %v", message, err)
+	}
+}
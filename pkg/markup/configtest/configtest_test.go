@@ -0,0 +1,115 @@
+package configtest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+type testConfig struct {
+	APPName string `default:"configure"`
+	DB      struct {
+		Name     string
+		Password string `required:"true"`
+		Port     uint   `default:"3306"`
+	}
+}
+
+func TestIsolatedConfiguration(t *testing.T) {
+	os.Setenv("CONFIGTEST_APPNAME", "process")
+	defer os.Unsetenv("CONFIGTEST_APPNAME")
+
+	for i := 0; i < 4; i++ {
+		i := i
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			t.Parallel()
+
+			files := NewFiles(map[string]string{
+				"config.yml":      "db:\n  name: db\n  password: secret\n",
+				"config.test.yml": fmt.Sprintf("db:\n  name: db%v\n", i),
+			})
+			configure := New(Env{"CONFIGTEST_DB_PORT": fmt.Sprint(5000 + i)}, files)
+			configure.ENVPrefix = "CONFIGTEST"
+
+			var config testConfig
+			if err := configure.Load(&config, "config.yml"); err != nil {
+				t.Fatal(err)
+			}
+
+			if config.APPName != "configure" || config.DB.Name != fmt.Sprint("db", i) || config.DB.Port != uint(5000+i) {
+				t.Errorf("configuration should be loaded from isolated env and files, but got %+v", config)
+			}
+
+			AssertSource(t, configure, "APPName", "default")
+			AssertSource(t, configure, "DB.Name", "file:config.test.yml")
+			AssertSource(t, configure, "DB.Port", "env")
+
+			files.Set("config.test.yml", "db:\n  name: reloaded\n")
+			if err := configure.Reload(); err != nil || config.DB.Name != "reloaded" {
+				t.Errorf("configuration should be reloaded from files, but got %v, %v", config.DB.Name, err)
+			}
+		})
+	}
+}
+
+func TestAssertRequired(t *testing.T) {
+	files := NewFiles(map[string]string{"config.json": `{"DB": {"Name": "db"}}`})
+
+	var config testConfig
+	err := New(nil, files).Load(&config, "config.json")
+	AssertRequired(t, err, "Password")
+	AssertError(t, err, "Password is required, but blank")
+
+	if info, err := files.Stat("config.json"); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("files should be regular files, but got %v", err)
+	}
+
+	if _, err := files.ReadFile("missing.json"); !os.IsNotExist(err) {
+		t.Errorf("missing files should not exist, but got %v", err)
+	}
+}
+
+func TestSaveInMemory(t *testing.T) {
+	name := fmt.Sprintf("/tmp/configtest-%v.yml", os.Getpid())
+	files := NewFiles(map[string]string{name: "db:\n  name: db\n  password: secret\n"})
+	configure := New(nil, files)
+
+	var config testConfig
+	if err := configure.Load(&config, name); err != nil {
+		t.Fatal(err)
+	}
+
+	config.DB.Name = "saved"
+	if err := configure.Save(&config, name); err != nil {
+		t.Fatalf("No error should happen when saving, but got %v", err)
+	}
+
+	if data, _ := files.ReadFile(name); string(data) != "db:\n  name: saved\n  password: secret\n" {
+		t.Errorf("configuration should be saved in memory, but got %s", data)
+	}
+
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		os.Remove(name)
+		t.Errorf("configuration should not be saved to disk, but got %v", err)
+	}
+}
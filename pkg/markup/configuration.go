@@ -25,12 +25,30 @@ import (
 	"os"
 	"reflect"
 	"regexp"
+	"sync"
 	"time"
 )
 
 type Configure struct {
 	*Config
 	configModTimes map[string]time.Time
+
+	mutex          sync.Mutex
+	reloadMutex    sync.Mutex
+	subscribers    []subscriber
+	pendingChanges []string
+	warnings       []Warning
+	migrations     map[int]Migration
+	config         interface{}
+	initialValue   reflect.Value
+	files          []string
+	sources        map[string]string
+	encrypted      map[string]bool
+	overrides      map[string]override
+	metrics        Metrics
+	activeFiles    []string
+	triedENVNames  map[string]bool
+	loadedValue    reflect.Value
 }
 
 type Config struct {
@@ -43,10 +61,53 @@ type Config struct {
 	AutoReloadInterval time.Duration
 	AutoReloadCallback func(config interface{})
 
+	// KeyProvider provides keys to decrypt encrypted values in configuration
+	// files, DefaultKeyProvider is used if it is nil
+	KeyProvider KeyProvider
+
+	// Logger logs events like files being loaded, env variables being applied
+	// or reloads failing, they are written to stderr if it is nil
+	Logger Logger
+
+	// RenderTemplates renders configuration files with text/template before
+	// decoding them, with the functions `env`, `default`, `required`, `file`,
+	// `b64dec` and `toYaml`, and TemplateData
+	RenderTemplates bool
+
+	// Profiles are the active profiles, available to templates, the comma
+	// separated env CONFIGURE_PROFILES is used if it is empty
+	Profiles []string
+
+	// SetValues assigns values to fields by their paths, like `path=value`
+	// or `path=@file` to assign the content of file, e.g.
+	// `contacts[0].email=admin@example.com`. They are applied over env
+	// variables, and under values set with Set
+	SetValues []string
+
+	// OverrideFile persists values set with Set, so that they survive
+	// restarts, overrides are kept in memory only if it is empty. It is read
+	// and written on the file system of the process, whatever FileSystem is
+	OverrideFile string
+
+	// ENVSource looks up env variables instead of the env of the process
+	ENVSource ENVSource
+
+	// FileSystem reads configuration files instead of the file system of the
+	// process
+	FileSystem FileSystem
+
 	// In case of json files, this field will be used only when compiled with
 	// go 1.10 or later.
 	// This field will be ignored when compiled with go versions lower than 1.10.
 	ErrorOnUnmatchedKeys bool
+
+	// ENVNaming converts names of fields to segments of their env variables,
+	// e.g. ScreamingSnakeCase, names are used as they are if it is nil
+	ENVNaming func(name string) string
+
+	// StrictENV returns an UnmatchedENVError if env variables with the env
+	// prefix don't match any field, e.g. a typo like `BHOJPUR_DB_PASWORD`
+	StrictENV bool
 }
 
 // New initialize a Configure
@@ -55,15 +116,16 @@ func New(config *Config) *Configure {
 		config = &Config{}
 	}
 
-	if os.Getenv("CONFIGURE_DEBUG_MODE") != "" {
+	configure := &Configure{Config: config}
+	if configure.getenv("CONFIGURE_DEBUG_MODE") != "" {
 		config.Debug = true
 	}
 
-	if os.Getenv("CONFIGURE_VERBOSE_MODE") != "" {
+	if configure.getenv("CONFIGURE_VERBOSE_MODE") != "" {
 		config.Verbose = true
 	}
 
-	if os.Getenv("CONFIGURE_SILENT_MODE") != "" {
+	if configure.getenv("CONFIGURE_SILENT_MODE") != "" {
 		config.Silent = true
 	}
 
@@ -71,7 +133,7 @@ func New(config *Config) *Configure {
 		config.AutoReloadInterval = time.Second
 	}
 
-	return &Configure{Config: config}
+	return configure
 }
 
 var testRegexp = regexp.MustCompile("_test|(\\.test$)")
@@ -79,7 +141,7 @@ var testRegexp = regexp.MustCompile("_test|(\\.test$)")
 // GetEnvironment get environment
 func (configure *Configure) GetEnvironment() string {
 	if configure.Environment == "" {
-		if env := os.Getenv("CONFIGURE_ENV"); env != "" {
+		if env := configure.getenv("CONFIGURE_ENV"); env != "" {
 			return env
 		}
 
@@ -105,23 +167,27 @@ func (configure *Configure) Load(config interface{}, files ...string) (err error
 	if !defaultValue.CanAddr() {
 		return fmt.Errorf("Config %v should be addressable", config)
 	}
+	initialValue := cloneValue(defaultValue)
+
+	if err = configure.loadOverrides(); err != nil {
+		return err
+	}
 	err, _ = configure.load(config, false, files...)
+	configure.recordLoad(false, false, config, err)
+
+	configure.mutex.Lock()
+	configure.config, configure.initialValue, configure.files = config, initialValue, files
+	if err == nil {
+		configure.loadedValue = cloneValue(defaultValue)
+	}
+	configure.mutex.Unlock()
 
 	if configure.Config.AutoReload {
 		go func() {
 			timer := time.NewTimer(configure.Config.AutoReloadInterval)
 			for range timer.C {
-				reflectPtr := reflect.New(reflect.ValueOf(config).Elem().Type())
-				reflectPtr.Elem().Set(defaultValue)
-
-				var changed bool
-				if err, changed = configure.load(reflectPtr.Interface(), true, files...); err == nil && changed {
-					reflect.ValueOf(config).Elem().Set(reflectPtr.Elem())
-					if configure.Config.AutoReloadCallback != nil {
-						configure.Config.AutoReloadCallback(config)
-					}
-				} else if err != nil {
-					fmt.Printf("Failed to reload configuration from %v, got error %v\n", files, err)
+				if _, err := configure.reload(config, initialValue, true, false, files...); err != nil {
+					configure.log(LevelError, "Failed to reload configuration", Fields{"files": files, "error": err})
 				}
 				timer.Reset(configure.Config.AutoReloadInterval)
 			}
@@ -23,6 +23,7 @@ package markup
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"os"
 	"reflect"
@@ -234,8 +235,8 @@ func TestUnmatchedKeyInTomltestConfigFile(t *testing.T) {
 		}
 
 		// The error should be of type UnmatchedTomlKeysError
-		tomlErr, ok := err.(*UnmatchedTomlKeysError)
-		if !ok {
+		var tomlErr *UnmatchedTomlKeysError
+		if !errors.As(err, &tomlErr) {
 			t.Errorf("Should get UnmatchedTomlKeysError error when loading configuration with extra keys")
 		}
 
@@ -271,8 +272,8 @@ func TestUnmatchedKeyInTomltestConfigFile(t *testing.T) {
 	}
 
 	// The error should be of type UnmatchedTomlKeysError
-	tomlErr, ok := err.(*UnmatchedTomlKeysError)
-	if !ok {
+	var tomlErr *UnmatchedTomlKeysError
+	if !errors.As(err, &tomlErr) {
 		t.Errorf("Should get UnmatchedTomlKeysError error when loading configuration with extra keys")
 	}
 
@@ -319,7 +320,7 @@ func TestUnmatchedKeyInYamltestConfigFile(t *testing.T) {
 			t.Errorf("Should get error when loading configuration with extra keys")
 
 			// The error should be of type *yaml.TypeError
-		} else if _, ok := err.(*yaml.TypeError); !ok {
+		} else if typeErr := new(yaml.TypeError); !errors.As(err, &typeErr) {
 			// || !strings.Contains(err.Error(), "not found in struct") {
 			t.Errorf("Error should be of type yaml.TypeError. Instead error is %v", err)
 		}
@@ -348,7 +349,7 @@ func TestUnmatchedKeyInYamltestConfigFile(t *testing.T) {
 		t.Errorf("Should get error when loading configuration with extra keys")
 
 		// The error should be of type *yaml.TypeError
-	} else if _, ok := err.(*yaml.TypeError); !ok {
+	} else if typeErr := new(yaml.TypeError); !errors.As(err, &typeErr) {
 		// || !strings.Contains(err.Error(), "not found in struct") {
 		t.Errorf("Error should be of type yaml.TypeError. Instead error is %v", err)
 	}
@@ -701,3 +702,92 @@ func TestLoadNestedConfig(t *testing.T) {
 	adminConfig := MenuList{}
 	New(&Config{Verbose: true}).Load(&adminConfig, "admin.yml")
 }
+
+type tlsConfig struct {
+	CertFile string
+	KeyFile  string
+	Port     uint `default:"443"`
+}
+
+type pointerConfig struct {
+	TLS     *tlsConfig
+	Cluster *struct {
+		Name string
+	}
+}
+
+func TestAllocatePointerStructForDefaults(t *testing.T) {
+	var result pointerConfig
+	if err := New(&Config{ENVPrefix: "PTR1"}).Load(&result); err != nil {
+		t.Fatalf("No error should happen when load configurations, but got %v", err)
+	}
+
+	if result.TLS == nil || result.TLS.Port != 443 {
+		t.Errorf("TLS should be allocated with default port, but got %+v", result.TLS)
+	}
+
+	if result.Cluster != nil {
+		t.Errorf("Cluster should stay nil when nothing targets its fields, but got %+v", result.Cluster)
+	}
+}
+
+func TestAllocatePointerStructForEnv(t *testing.T) {
+	os.Setenv("PTR2_TLS_CERTFILE", "server.crt")
+	os.Setenv("PTR2_Cluster_Name", "primary")
+	defer os.Unsetenv("PTR2_TLS_CERTFILE")
+	defer os.Unsetenv("PTR2_Cluster_Name")
+
+	var result pointerConfig
+	if err := New(&Config{ENVPrefix: "PTR2"}).Load(&result); err != nil {
+		t.Fatalf("No error should happen when load configurations, but got %v", err)
+	}
+
+	if result.TLS == nil || result.TLS.CertFile != "server.crt" || result.TLS.Port != 443 {
+		t.Errorf("TLS should be loaded from env, but got %+v", result.TLS)
+	}
+
+	if result.Cluster == nil || result.Cluster.Name != "primary" {
+		t.Errorf("Cluster should be loaded from env, but got %+v", result.Cluster)
+	}
+}
+
+type requiredPointerConfig struct {
+	Cluster *struct {
+		Name  string `required:"true"`
+		Nodes int
+	}
+}
+
+func TestAllocatePointerStructOnlyForMatchedEnv(t *testing.T) {
+	os.Setenv("PTR3_CLUSTER_UNKNOWN", "value")
+	defer os.Unsetenv("PTR3_CLUSTER_UNKNOWN")
+
+	var result requiredPointerConfig
+	if err := New(&Config{ENVPrefix: "PTR3"}).Load(&result); err != nil {
+		t.Fatalf("No error should happen when env variables don't match fields, but got %v", err)
+	}
+
+	if result.Cluster != nil {
+		t.Errorf("Cluster should stay nil when env variables don't match its fields, but got %+v", result.Cluster)
+	}
+
+	os.Setenv("PTR3_CLUSTER_NODES", "3")
+	defer os.Unsetenv("PTR3_CLUSTER_NODES")
+
+	var requiredErr *RequiredError
+	if err := New(&Config{ENVPrefix: "PTR3"}).Load(&result); !errors.As(err, &requiredErr) || requiredErr.Field != "Name" {
+		t.Errorf("required fields of sections allocated for env variables should be checked, but got %v", err)
+	}
+
+	os.Setenv("PTR3_CLUSTER_NAME", "primary")
+	defer os.Unsetenv("PTR3_CLUSTER_NAME")
+
+	result = requiredPointerConfig{}
+	if err := New(&Config{ENVPrefix: "PTR3"}).Load(&result); err != nil {
+		t.Fatalf("No error should happen when load configurations, but got %v", err)
+	}
+
+	if result.Cluster == nil || result.Cluster.Nodes != 3 || result.Cluster.Name != "primary" {
+		t.Errorf("Cluster should be loaded from env, but got %+v", result.Cluster)
+	}
+}
@@ -0,0 +1,452 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bhojpur/configure/pkg/toml"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// DecodeError is returned by Load when a configuration file can't be decoded,
+// with the position of the error in the same shape for every format
+type DecodeError struct {
+	File string
+	// Line and Column start at 1, they are 0 when unknown
+	Line   int
+	Column int
+	// Path of the key in the file, e.g. `db.port` or `contacts[0].email`
+	Path string
+	// Excerpt holds the lines of the file around Line, marking the error
+	Excerpt string
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	position := e.File
+	if e.Line > 0 {
+		position += ":" + strconv.Itoa(e.Line)
+		if e.Column > 0 {
+			position += ":" + strconv.Itoa(e.Column)
+		}
+	}
+	if e.Path != "" {
+		position += ": " + e.Path
+	}
+	return fmt.Sprintf("%v: %v", position, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	yamlLineRegexp        = regexp.MustCompile(`line (\d+):`)
+	tomlKeyRegexp         = regexp.MustCompile(`TOML key "([^"]+)"`)
+	jsonUnknownFieldRegex = regexp.MustCompile(`json: unknown field "([^"]+)"`)
+)
+
+// newDecodeError wraps err returned when decoding data of file in format
+// with the position of the error. Positions refer to data as it was decoded,
+// after templates have been rendered
+func newDecodeError(file string, data []byte, format string, err error) error {
+	var decodeErr *DecodeError
+	if err == nil || errors.As(err, &decodeErr) {
+		return err
+	}
+
+	decodeErr = &DecodeError{File: file, Err: err}
+	switch format {
+	case FormatYAML:
+		if match := yamlLineRegexp.FindStringSubmatch(err.Error()); match != nil {
+			decodeErr.Line, _ = strconv.Atoi(match[1])
+			// unknown keys are marked at the key, invalid values at the value
+			unknownKey := strings.Contains(err.Error(), "not found in type")
+			decodeErr.Path, decodeErr.Column = findYAMLKey(data, decodeErr.Line, unknownKey)
+		}
+	case FormatTOML:
+		var parseErr toml.ParseError
+		var unmatchedErr *UnmatchedTomlKeysError
+		switch {
+		case errors.As(err, &parseErr):
+			decodeErr.Path = parseErr.LastKey
+			if decodeErr.Line, decodeErr.Column = getOffsetPosition(data, parseErr.Position.Start); decodeErr.Line == 0 {
+				decodeErr.Line = parseErr.Position.Line
+			}
+		case errors.As(err, &unmatchedErr) && len(unmatchedErr.Keys) > 0:
+			decodeErr.Path = unmatchedErr.Keys[0].String()
+			decodeErr.Line, decodeErr.Column = findTOMLKey(data, decodeErr.Path)
+		default:
+			if match := tomlKeyRegexp.FindStringSubmatch(err.Error()); match != nil {
+				decodeErr.Path = match[1]
+				decodeErr.Line, decodeErr.Column = findTOMLKey(data, decodeErr.Path)
+			}
+		}
+	case FormatJSON:
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			decodeErr.Line, decodeErr.Column = getOffsetPosition(data, int(syntaxErr.Offset)-1)
+			decodeErr.Path, _ = findJSONKey(data, func(path string, offset int64) bool { return offset >= syntaxErr.Offset })
+		case errors.As(err, &typeErr):
+			// the offset of type errors is the end of the value
+			decodeErr.Path, _ = findJSONKey(data, func(path string, offset int64) bool { return offset >= typeErr.Offset })
+			if decodeErr.Path == "" {
+				decodeErr.Path = typeErr.Field
+			}
+			decodeErr.Line, decodeErr.Column = getOffsetPosition(data, int(typeErr.Offset)-1)
+		default:
+			if match := jsonUnknownFieldRegex.FindStringSubmatch(err.Error()); match != nil {
+				var offset int64
+				decodeErr.Path, offset = findJSONKey(data, func(path string, offset int64) bool {
+					return path == match[1] || strings.HasSuffix(path, "."+match[1])
+				})
+				if decodeErr.Path != "" {
+					decodeErr.Line, decodeErr.Column = getOffsetPosition(data, int(offset)-len(strconv.Quote(match[1])))
+				}
+			}
+		}
+	}
+
+	decodeErr.Excerpt = getExcerpt(data, decodeErr.Line, decodeErr.Column)
+	return decodeErr
+}
+
+// relocateDecodeError moves the position of decodeErr, located in data
+// rewritten by selectDocuments or processDocument, to source. Keys renamed by
+// edits are looked up by their names in source, the position is left out if
+// the key can't be found
+func (configure *Configure) relocateDecodeError(decodeErr *DecodeError, source []byte, format string, edits []documentEdit) {
+	path := decodeErr.Path
+	// children are renamed after their parents
+	for i := len(edits) - 1; i >= 0; i-- {
+		edit := edits[i]
+		if edit.rename == "" {
+			continue
+		}
+
+		renamed := documentPath(appendKey(edit.keys[:len(edit.keys)-1], edit.rename))
+		if path == renamed || strings.HasPrefix(path, renamed+".") || strings.HasPrefix(path, renamed+"[") {
+			path = documentPath(edit.keys) + path[len(renamed):]
+		}
+	}
+
+	decodeErr.Path, decodeErr.Line, decodeErr.Column = path, 0, 0
+	if path != "" {
+		switch format {
+		case FormatYAML:
+			unknownKey := strings.Contains(decodeErr.Err.Error(), "not found in type")
+			decodeErr.Line, decodeErr.Column = configure.findYAMLPath(source, path, unknownKey)
+		case FormatTOML:
+			decodeErr.Line, decodeErr.Column = findTOMLKey(source, path)
+		case FormatJSON:
+			decodeErr.Line, decodeErr.Column = findJSONPath(source, path)
+		}
+	}
+	decodeErr.Excerpt = getExcerpt(source, decodeErr.Line, decodeErr.Column)
+}
+
+// getOffsetPosition returns the line and column of offset in data
+func getOffsetPosition(data []byte, offset int) (line, column int) {
+	if offset < 0 || offset > len(data) {
+		return 0, 0
+	}
+	line = bytes.Count(data[:offset], []byte("\n")) + 1
+	column = offset - bytes.LastIndexByte(data[:offset], '\n')
+	return line, column
+}
+
+// getExcerpt returns line of data with the line before it, marking column
+func getExcerpt(data []byte, line, column int) string {
+	lines := strings.Split(string(data), "\n")
+	if line <= 0 || line > len(lines) {
+		return ""
+	}
+
+	var (
+		b     strings.Builder
+		width = len(strconv.Itoa(line))
+	)
+	for i := line - 1; i <= line; i++ {
+		if i < 1 {
+			continue
+		}
+		marker := " "
+		if i == line {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "%v %*d | %v\n", marker, width, i, lines[i-1])
+	}
+	if column > 0 {
+		fmt.Fprintf(&b, "  %v | %v^\n", strings.Repeat(" ", width), strings.Repeat(" ", column-1))
+	}
+	return b.String()
+}
+
+// findYAMLKey returns the path of the key or list item at line, and the
+// column of its value, or of the key if atKey is true
+func findYAMLKey(data []byte, line int, atKey bool) (path string, column int) {
+	var node yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &node); err != nil {
+		return "", 0
+	}
+
+	var find func(node *yamlv3.Node, path string) (string, int, bool)
+	find = func(node *yamlv3.Node, path string) (string, int, bool) {
+		switch node.Kind {
+		case yamlv3.DocumentNode:
+			for _, child := range node.Content {
+				if path, column, ok := find(child, path); ok {
+					return path, column, ok
+				}
+			}
+		case yamlv3.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				keyPath := joinPath(path, key.Value)
+				if key.Line == line {
+					if !atKey && value.Line == line && value.Kind == yamlv3.ScalarNode {
+						return keyPath, value.Column, true
+					}
+					return keyPath, key.Column, true
+				}
+				if path, column, ok := find(value, keyPath); ok {
+					return path, column, ok
+				}
+			}
+		case yamlv3.SequenceNode:
+			for idx, item := range node.Content {
+				itemPath := fmt.Sprintf("%v[%v]", path, idx)
+				if item.Kind == yamlv3.ScalarNode && item.Line == line {
+					return itemPath, item.Column, true
+				}
+				if path, column, ok := find(item, itemPath); ok {
+					return path, column, ok
+				}
+			}
+		}
+		return "", 0, false
+	}
+
+	path, column, _ = find(&node, "")
+	return path, column
+}
+
+// findYAMLPath returns the line and column of the value at path in the YAML
+// stream data, or of its key if atKey is true. Documents are searched from the
+// last one, as they override earlier ones, leaving out the documents of other
+// environments and profiles in multi-document streams
+func (configure *Configure) findYAMLPath(data []byte, path string, atKey bool) (line, column int) {
+	var (
+		documents []*yamlv3.Node
+		decoder   = yamlv3.NewDecoder(bytes.NewReader(data))
+	)
+	for {
+		var node yamlv3.Node
+		if err := decoder.Decode(&node); err != nil {
+			break
+		}
+		documents = append(documents, &node)
+	}
+
+	for i := len(documents) - 1; i >= 0; i-- {
+		var doc map[string]interface{}
+		if err := documents[i].Decode(&doc); err == nil && len(documents) > 1 && !configure.matchDocument(doc) {
+			continue
+		}
+
+		if line, column = findYAMLNode(documents[i], path, atKey); line > 0 {
+			return line, column
+		}
+	}
+	return 0, 0
+}
+
+// findYAMLNode returns the line and column of the value at path in the YAML
+// document node, or of its key if atKey is true or the value is not a scalar
+func findYAMLNode(node *yamlv3.Node, path string, atKey bool) (line, column int) {
+	var key *yamlv3.Node
+	if node.Kind == yamlv3.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for rest := path; rest != ""; {
+		matches := pathSegmentRegexp.FindStringSubmatch(rest)
+		if matches == nil {
+			return 0, 0
+		}
+		rest = rest[len(matches[0]):]
+
+		if node.Kind == yamlv3.AliasNode {
+			node = node.Alias
+		}
+
+		switch {
+		case matches[2] != "" && node.Kind == yamlv3.SequenceNode:
+			idx, _ := strconv.Atoi(matches[2])
+			if idx >= len(node.Content) {
+				return 0, 0
+			}
+			key, node = nil, node.Content[idx]
+		case matches[2] == "" && node.Kind == yamlv3.MappingNode:
+			var found bool
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == matches[1] {
+					key, node, found = node.Content[i], node.Content[i+1], true
+					break
+				}
+			}
+			if !found {
+				return 0, 0
+			}
+		default:
+			return 0, 0
+		}
+	}
+
+	if key != nil && (atKey || node.Kind != yamlv3.ScalarNode) {
+		return key.Line, key.Column
+	}
+	return node.Line, node.Column
+}
+
+// findTOMLKey returns the line and column of the key at path, e.g. `db.port`
+func findTOMLKey(data []byte, path string) (line, column int) {
+	var table string
+	for i, text := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(text)
+		if strings.HasPrefix(trimmed, "[") {
+			table = strings.Trim(strings.SplitN(trimmed, "#", 2)[0], "[] \t")
+			if strings.EqualFold(table, path) {
+				return i + 1, strings.Index(text, table) + 1
+			}
+			continue
+		}
+
+		if parts := strings.SplitN(trimmed, "=", 2); len(parts) == 2 {
+			key := strings.Trim(strings.TrimSpace(parts[0]), `"'`)
+			if strings.EqualFold(joinPath(table, key), path) {
+				return i + 1, strings.Index(text, strings.TrimSpace(parts[0])) + 1
+			}
+		}
+	}
+	return 0, 0
+}
+
+// findJSONPath returns the line and column of the key at path, or of the end
+// of the list item at path
+func findJSONPath(data []byte, path string) (line, column int) {
+	found, offset := findJSONKey(data, func(key string, offset int64) bool { return key == path })
+	if found != path {
+		return 0, 0
+	}
+
+	if strings.HasSuffix(path, "]") {
+		return getOffsetPosition(data, int(offset)-1)
+	}
+	name := path[strings.LastIndexAny(path, ".]")+1:]
+	return getOffsetPosition(data, int(offset)-len(strconv.Quote(name)))
+}
+
+// findJSONKey returns the path of the first key of data matching fn, and the
+// offset of the end of the key
+func findJSONKey(data []byte, fn func(path string, offset int64) bool) (string, int64) {
+	type frame struct {
+		path     string
+		isObject bool
+		index    int
+		isKey    bool
+	}
+
+	var (
+		decoder = json.NewDecoder(bytes.NewReader(data))
+		stack   []*frame
+		last    string
+	)
+
+	// valuePath returns the path of the value being read in the top frame
+	valuePath := func() string {
+		if len(stack) == 0 {
+			return ""
+		}
+		if top := stack[len(stack)-1]; !top.isObject {
+			return fmt.Sprintf("%v[%v]", top.path, top.index)
+		}
+		return last
+	}
+
+	// endValue updates the top frame after a value has been read
+	endValue := func() {
+		if len(stack) > 0 {
+			if top := stack[len(stack)-1]; top.isObject {
+				top.isKey = true
+			} else {
+				top.index++
+			}
+		}
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return last, decoder.InputOffset()
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			stack = append(stack, &frame{path: valuePath(), isObject: token == json.Delim('{'), isKey: true})
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			path := stack[len(stack)-1].path
+			stack = stack[:len(stack)-1]
+			endValue()
+			if fn(path, decoder.InputOffset()) {
+				return path, decoder.InputOffset()
+			}
+			continue
+		}
+
+		if len(stack) > 0 {
+			if top := stack[len(stack)-1]; top.isObject && top.isKey {
+				last = joinPath(top.path, fmt.Sprint(token))
+				top.isKey = false
+				if fn(last, decoder.InputOffset()) {
+					return last, decoder.InputOffset()
+				}
+				continue
+			}
+		}
+
+		path := valuePath()
+		endValue()
+		if fn(path, decoder.InputOffset()) {
+			return path, decoder.InputOffset()
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bhojpur/configure/pkg/toml"
+	"gopkg.in/yaml.v2"
+)
+
+func TestDecodeError(t *testing.T) {
+	type decodeConfig struct {
+		Name     string
+		DB       struct{ Port int }
+		Contacts []struct {
+			Email string
+			Port  int
+		}
+	}
+
+	for _, c := range []struct {
+		ext, content string
+		line, column int
+		path         string
+		excerpt      string
+	}{
+		{"yml", "name: a\ndb:\n  port: abc\n", 3, 9, "db.port", "> 3 |   port: abc\n    |         ^\n"},
+		{"yml", "name: a\ndb:\n  port: 1\n  foo: 2\n", 4, 3, "db.foo", "> 4 |   foo: 2\n"},
+		{"yml", "contacts:\n  - email: a\n    port: abc\n", 3, 11, "contacts[0].port", "> 3 |     port: abc\n"},
+		{"toml", "name = 'a'\n[db]\nport = 'abc'\n", 3, 1, "db.port", "> 3 | port = 'abc'\n"},
+		{"toml", "name = 'a'\n[db]\nport = \n", 3, 8, "db.port", "> 3 | port = \n"},
+		{"toml", "name = 'a'\n[db]\nport = 1\nfoo = 2\n", 4, 1, "db.foo", "> 4 | foo = 2\n"},
+		{"json", "{\n  \"db\": {\n    \"port\": \"abc\"\n  }\n}\n", 3, 17, "db.port", "> 3 |     \"port\": \"abc\"\n"},
+		{"json", "{\n  \"db\": {\n    \"port\": 1,\n    \"foo\": 2\n  }\n}\n", 4, 5, "db.foo", "> 4 |     \"foo\": 2\n"},
+		{"json", "{\n  \"contacts\": [{\"email\": \"a\"}, {\"port\": \"x\"}]\n}\n", 2, 43, "contacts[1].port", ""},
+		{"json", "{\n  \"name\": \"a\",\n}\n", 3, 1, "name", "  2 |   \"name\": \"a\",\n> 3 | }\n    | ^\n"},
+	} {
+		file, err := ioutil.TempFile("/tmp", "configure.*."+c.ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.WriteString(c.content)
+		file.Close()
+		defer os.Remove(file.Name())
+
+		var config decodeConfig
+		err = New(&Config{ENVPrefix: "DECODE1", ErrorOnUnmatchedKeys: true}).Load(&config, file.Name())
+
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("DecodeError should be returned for %q, but got %v", c.content, err)
+			continue
+		}
+
+		if decodeErr.File != file.Name() || decodeErr.Line != c.line || decodeErr.Column != c.column || decodeErr.Path != c.path {
+			t.Errorf("DecodeError of %q should be at %v:%v %v, but got %v:%v %v", c.content, c.line, c.column, c.path, decodeErr.Line, decodeErr.Column, decodeErr.Path)
+		}
+
+		if !strings.Contains(decodeErr.Excerpt, c.excerpt) {
+			t.Errorf("DecodeError of %q should have excerpt %q, but got %q", c.content, c.excerpt, decodeErr.Excerpt)
+		}
+
+		if prefix := fmt.Sprintf("%v:%v:%v: %v: ", file.Name(), c.line, c.column, c.path); !strings.HasPrefix(err.Error(), prefix) {
+			t.Errorf("error should start with %v, but got %v", prefix, err)
+		}
+	}
+}
+
+func TestDecodeErrorUnwrap(t *testing.T) {
+	for _, c := range []struct {
+		ext, content string
+		target       interface{}
+	}{
+		{"yml", "db:\n  port: abc\n", new(*yaml.TypeError)},
+		{"toml", "db = \n", new(toml.ParseError)},
+		{"json", "{\"db\": {\"port\": \"abc\"}}", new(*json.UnmarshalTypeError)},
+	} {
+		file, err := ioutil.TempFile("/tmp", "configure.*."+c.ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.WriteString(c.content)
+		file.Close()
+		defer os.Remove(file.Name())
+
+		var config struct{ DB struct{ Port int } }
+		if err := New(&Config{ENVPrefix: "DECODE2"}).Load(&config, file.Name()); !errors.As(err, c.target) {
+			t.Errorf("DecodeError should unwrap to %T, but got %v", c.target, err)
+		}
+	}
+}
+
+func TestDecodeErrorOfRewrittenDocuments(t *testing.T) {
+	for _, c := range []struct {
+		ext, content string
+		line, column int
+		path         string
+		excerpt      string
+	}{
+		{"yml", "# database\ndb:\n  name: a\n\n  pool: abc\n", 5, 9, "db.pool", "> 5 |   pool: abc\n    |         ^\n"},
+		{"yml", "db:\n  pool: 1\n---\nenvironment: test\ndb:\n  pool: x\n---\nenvironment: production\ndb:\n  pool: abc\n", 10, 9, "db.pool", "> 10 |   pool: abc\n"},
+		{"toml", "[db]\nname = 'a'\n\npool = 'abc'\n", 4, 1, "db.pool", "> 4 | pool = 'abc'\n"},
+		{"json", "{\n  \"db\": {\n    \"name\": \"a\",\n\n    \"pool\": \"abc\"\n  }\n}\n", 5, 5, "db.pool", "> 5 |     \"pool\": \"abc\"\n"},
+	} {
+		file, err := ioutil.TempFile("/tmp", "configure.*."+c.ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.WriteString(c.content)
+		file.Close()
+		defer os.Remove(file.Name())
+
+		var config legacyConfig
+		err = New(&Config{ENVPrefix: "DECODE3", Environment: "production", Silent: true}).Load(&config, file.Name())
+
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("DecodeError should be returned for %q, but got %v", c.content, err)
+			continue
+		}
+
+		if decodeErr.Line != c.line || decodeErr.Column != c.column || decodeErr.Path != c.path {
+			t.Errorf("DecodeError of %q should be at %v:%v %v of the file, but got %v:%v %v", c.content, c.line, c.column, c.path, decodeErr.Line, decodeErr.Column, decodeErr.Path)
+		}
+
+		if !strings.Contains(decodeErr.Excerpt, c.excerpt) {
+			t.Errorf("DecodeError of %q should have excerpt %q, but got %q", c.content, c.excerpt, decodeErr.Excerpt)
+		}
+	}
+}
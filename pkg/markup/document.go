@@ -0,0 +1,441 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/bhojpur/configure/pkg/toml"
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Supported formats of configuration files
+const (
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+	FormatJSON = "json"
+)
+
+// getFileFormat returns the format of file based on its extension, or an
+// empty string if it is unknown
+func getFileFormat(file string) string {
+	switch {
+	case strings.HasSuffix(file, ".yaml") || strings.HasSuffix(file, ".yml"):
+		return FormatYAML
+	case strings.HasSuffix(file, ".toml"):
+		return FormatTOML
+	case strings.HasSuffix(file, ".json"):
+		return FormatJSON
+	}
+	return ""
+}
+
+// detectFormat returns the format of data in the same order processFile
+// tries to decode files without a known extension
+func detectFormat(data []byte) string {
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(data), &doc); err == nil {
+		return FormatTOML
+	}
+	if err := json.Unmarshal(data, &doc); err == nil {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+// decodeDocument decodes data into a generic document tree
+func decodeDocument(data []byte, format string) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+
+	switch format {
+	case FormatYAML:
+		var value interface{}
+		if err := yaml.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		if value == nil {
+			return map[string]interface{}{}, nil
+		}
+		if m, ok := normalizeValue(value).(map[string]interface{}); ok {
+			return m, nil
+		}
+		return nil, fmt.Errorf("yaml document should be a mapping, got %T", value)
+	case FormatTOML:
+		if _, err := toml.Decode(string(data), &doc); err != nil {
+			return nil, err
+		}
+	case FormatJSON:
+		if len(bytes.TrimSpace(data)) == 0 {
+			return map[string]interface{}{}, nil
+		}
+		// keep numbers as they are written, large integers don't fit float64
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format %v", format)
+	}
+
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	return doc, nil
+}
+
+// encodeDocument encodes a generic document tree in format
+func encodeDocument(doc map[string]interface{}, format string) ([]byte, error) {
+	switch format {
+	case FormatYAML:
+		return yaml.Marshal(doc)
+	case FormatTOML:
+		var buffer bytes.Buffer
+		err := toml.NewEncoder(&buffer).Encode(doc)
+		return buffer.Bytes(), err
+	case FormatJSON:
+		return json.MarshalIndent(doc, "", "  ")
+	}
+	return nil, fmt.Errorf("unsupported format %v", format)
+}
+
+// normalizeValue converts yaml's map[interface{}]interface{} values into
+// map[string]interface{}, so that every format shares the same tree
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = normalizeValue(value)
+		}
+		return m
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = normalizeValue(value)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = normalizeValue(value)
+		}
+		return v
+	}
+	return value
+}
+
+// documentList returns the maps held by a list value of the document tree
+func documentList(value interface{}) []map[string]interface{} {
+	var results []map[string]interface{}
+	switch v := value.(type) {
+	case []map[string]interface{}:
+		results = v
+	case []interface{}:
+		for _, elem := range v {
+			if m, ok := elem.(map[string]interface{}); ok {
+				results = append(results, m)
+			}
+		}
+	}
+	return results
+}
+
+// documentKey returns the key of a struct field in format, and whether the
+// fields of an embedded struct are inlined into its parent
+func documentKey(fieldStruct *reflect.StructField, format string) (key string, inline bool) {
+	tag := strings.Split(fieldStruct.Tag.Get(format), ",")
+	key = tag[0]
+
+	fieldType := fieldStruct.Type
+	for fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+
+	switch format {
+	case FormatYAML:
+		for _, flag := range tag[1:] {
+			if flag == "inline" {
+				return "", true
+			}
+		}
+		if key == "" {
+			key = strings.ToLower(fieldStruct.Name)
+		}
+	default:
+		if key == "" && fieldStruct.Anonymous && fieldType.Kind() == reflect.Struct {
+			return "", true
+		}
+		if key == "" {
+			key = fieldStruct.Name
+		}
+	}
+	return key, false
+}
+
+// documentFieldType returns the type of the value at key of a document
+// decoded into a value of t, or nil if it is unknown
+func documentFieldType(t reflect.Type, key interface{}, format string) reflect.Type {
+	fieldType, _ := documentField(t, key, format)
+	return fieldType
+}
+
+// documentField returns the type of the value at key of a document decoded
+// into a value of t, and its path in t, e.g. `Name`, `Base.Name` for fields of
+// embedded structs, `[0]` or the key of maps, or nil if it is unknown
+func documentField(t reflect.Type, key interface{}, format string) (reflect.Type, string) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return nil, ""
+	}
+
+	switch t.Kind() {
+	case reflect.Map:
+		return t.Elem(), fmt.Sprint(key)
+	case reflect.Slice, reflect.Array:
+		return t.Elem(), fmt.Sprintf("[%v]", key)
+	case reflect.Struct:
+		name, ok := key.(string)
+		if !ok {
+			return nil, ""
+		}
+
+		for i := 0; i < t.NumField(); i++ {
+			fieldStruct := t.Field(i)
+			if fieldStruct.PkgPath != "" && !fieldStruct.Anonymous {
+				continue
+			}
+
+			docKey, inline := documentKey(&fieldStruct, format)
+			if inline {
+				if fieldType, path := documentField(fieldStruct.Type, key, format); fieldType != nil {
+					return fieldType, joinPath(fieldStruct.Name, path)
+				}
+			} else if docKey == name || (format != FormatYAML && strings.EqualFold(docKey, name)) {
+				return fieldStruct.Type, fieldStruct.Name
+			}
+		}
+	}
+	return nil, ""
+}
+
+// documentFieldPath returns the path of the field at keys of a document
+// decoded into a value of t, e.g. `Contacts[0].Email`, or false if it is
+// unknown
+func documentFieldPath(t reflect.Type, keys []interface{}, format string) (string, bool) {
+	var path string
+	for _, key := range keys {
+		var name string
+		if t, name = documentField(t, key, format); t == nil {
+			return "", false
+		}
+
+		if strings.HasPrefix(name, "[") {
+			path += name
+		} else {
+			path = joinPath(path, name)
+		}
+	}
+	return path, path != ""
+}
+
+// findDocumentKey returns the key of doc matching key, the same way format's
+// decoder does
+func findDocumentKey(doc map[string]interface{}, key, format string) (string, bool) {
+	if _, ok := doc[key]; ok {
+		return key, true
+	}
+
+	if format != FormatYAML {
+		for k := range doc {
+			if strings.EqualFold(k, key) {
+				return k, true
+			}
+		}
+	}
+	return "", false
+}
+
+// documentEdit renames, deletes or replaces the value at keys of a document
+// tree, keys are strings for mappings and ints for lists
+type documentEdit struct {
+	keys   []interface{}
+	rename string
+	delete bool
+	value  interface{}
+}
+
+// appendKey returns keys followed by key, without sharing keys' array
+func appendKey(keys []interface{}, key interface{}) []interface{} {
+	return append(keys[:len(keys):len(keys)], key)
+}
+
+// documentPath returns the path of keys, e.g. `contacts[0].email`
+func documentPath(keys []interface{}) string {
+	var path string
+	for _, key := range keys {
+		if idx, ok := key.(int); ok {
+			path = fmt.Sprintf("%v[%v]", path, idx)
+		} else {
+			path = joinPath(path, fmt.Sprint(key))
+		}
+	}
+	return path
+}
+
+// editYAMLDocument applies edits to the nodes of YAML data, so that comments
+// and layout are kept. It returns false if edits can't be applied to nodes,
+// like keys merged from other mappings
+func editYAMLDocument(data []byte, edits []documentEdit) ([]byte, bool) {
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &root); err != nil {
+		return nil, false
+	}
+
+	for _, edit := range edits {
+		parent, idx, ok := lookupYAMLNode(&root, edit.keys)
+		if !ok {
+			return nil, false
+		}
+
+		switch {
+		case edit.rename != "" && parent.Kind == yamlv3.MappingNode:
+			parent.Content[idx].Value = edit.rename
+		case edit.delete && parent.Kind == yamlv3.MappingNode:
+			parent.Content = append(parent.Content[:idx], parent.Content[idx+2:]...)
+		case !edit.delete && edit.rename == "":
+			node := parent.Content[idx]
+			if parent.Kind == yamlv3.MappingNode {
+				node = parent.Content[idx+1]
+			}
+
+			var value yamlv3.Node
+			if err := value.Encode(edit.value); err != nil {
+				return nil, false
+			}
+			// keep the node itself, as aliases may point to it
+			value.Anchor, value.HeadComment, value.LineComment, value.FootComment = node.Anchor, node.HeadComment, node.LineComment, node.FootComment
+			*node = value
+		default:
+			return nil, false
+		}
+	}
+
+	var buffer bytes.Buffer
+	encoder := yamlv3.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&root); err != nil {
+		return nil, false
+	}
+	return buffer.Bytes(), encoder.Close() == nil
+}
+
+// lookupYAMLNode returns the mapping or list holding the value at keys of
+// node, and the index of its key or item
+func lookupYAMLNode(node *yamlv3.Node, keys []interface{}) (*yamlv3.Node, int, bool) {
+	if node.Kind == yamlv3.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for i, key := range keys {
+		for node.Kind == yamlv3.AliasNode {
+			node = node.Alias
+		}
+
+		idx := -1
+		switch key := key.(type) {
+		case string:
+			for j := 0; node.Kind == yamlv3.MappingNode && j+1 < len(node.Content); j += 2 {
+				if node.Content[j].Value == key {
+					idx = j
+					break
+				}
+			}
+		case int:
+			if node.Kind == yamlv3.SequenceNode && key < len(node.Content) {
+				idx = key
+			}
+		}
+
+		if idx < 0 {
+			return nil, 0, false
+		} else if i == len(keys)-1 {
+			return node, idx, true
+		}
+
+		if node.Kind == yamlv3.MappingNode {
+			node = node.Content[idx+1]
+		} else {
+			node = node.Content[idx]
+		}
+	}
+	return nil, 0, false
+}
+
+// processDocument rewrites data when its document tree needs to be changed
+// before decoding it into config. Only documents with keys to change are
+// rewritten, YAML documents keep their comments unless they are migrated. It
+// returns the edits of keys, so that errors can be located in data
+func (configure *Configure) processDocument(config interface{}, file string, data []byte) ([]byte, []documentEdit, error) {
+	configType := reflect.TypeOf(config)
+	if !hasLegacyTags(configType) && !configure.hasMigrations() && !hasEncryptedValues(data) {
+		return data, nil, nil
+	}
+
+	format := getFileFormat(file)
+	if format == "" {
+		format = detectFormat(data)
+	}
+
+	doc, err := decodeDocument(data, format)
+	if err != nil {
+		// leave it to the decoder to report the error
+		return data, nil, nil
+	}
+
+	migrated, err := configure.migrateDocument(file, configType, doc, format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var edits []documentEdit
+	configure.processLegacyKeys(file, configType, doc, format, nil, &edits)
+	if err := configure.decryptDocument(file, configType, doc, format, &edits); err != nil {
+		return nil, nil, err
+	}
+
+	if !migrated && len(edits) == 0 {
+		return data, nil, nil
+	}
+
+	if !migrated && format == FormatYAML {
+		if result, ok := editYAMLDocument(data, edits); ok {
+			return result, edits, nil
+		}
+	}
+	result, err := encodeDocument(doc, format)
+	return result, edits, err
+}
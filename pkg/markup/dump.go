@@ -0,0 +1,335 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FormatENV is the env file format of Dump, one `NAME=value` per line
+const FormatENV = "env"
+
+// RedactedPlaceholder is written by Dump instead of the values of fields
+// tagged with `secret:"true"`
+const RedactedPlaceholder = "<redacted>"
+
+// Sources of loaded values, values loaded from files have the source
+// `file:<path>`
+const (
+	SourceDefault  = "default"
+	SourceENV      = "env"
+	SourceOverride = "override"
+)
+
+// GetSource returns where the value of the field at path was loaded from,
+// e.g. `default`, `file:config.yml` or `env`, or an empty string if it has not
+// been loaded. Fields inherit the source of their parents, e.g. elements of a
+// slice loaded from a file
+func (configure *Configure) GetSource(path string) string {
+	configure.mutex.Lock()
+	defer configure.mutex.Unlock()
+
+	for {
+		if source, ok := configure.sources[path]; ok {
+			return source
+		}
+
+		idx := strings.LastIndexAny(path, ".[")
+		if idx <= 0 {
+			return ""
+		}
+		path = path[:idx]
+	}
+}
+
+// sourceRecorder records the sources of the fields changed by each layer of
+// a load, and the paths of the fields decrypted from envelopes
+type sourceRecorder struct {
+	value     reflect.Value
+	snapshot  reflect.Value
+	sources   map[string]string
+	encrypted map[string]bool
+}
+
+func newSourceRecorder(config interface{}) *sourceRecorder {
+	value := reflect.Indirect(reflect.ValueOf(config))
+	return &sourceRecorder{value: value, snapshot: cloneValue(value), sources: map[string]string{}, encrypted: map[string]bool{}}
+}
+
+func (recorder *sourceRecorder) record(source string) {
+	for _, path := range diffValues("", recorder.snapshot, recorder.value, nil) {
+		// elements of slices are written with their slices
+		for strings.HasSuffix(path, "]") {
+			path = path[:strings.LastIndex(path, "[")]
+		}
+		recorder.sources[path] = source
+	}
+	recorder.snapshot = cloneValue(recorder.value)
+}
+
+// saveSources replaces the sources of previous loads with the ones recorded
+// by recorder, every load starts from the initial value of the configuration
+func (configure *Configure) saveSources(recorder *sourceRecorder) {
+	configure.mutex.Lock()
+	defer configure.mutex.Unlock()
+	configure.sources, configure.encrypted = recorder.sources, recorder.encrypted
+}
+
+// isEncrypted reports whether the value at path, or a value nested in it, has
+// been decrypted from an envelope
+func isEncrypted(encrypted map[string]bool, path string) bool {
+	for encryptedPath := range encrypted {
+		if encryptedPath == path || strings.HasPrefix(encryptedPath, path+".") || strings.HasPrefix(encryptedPath, path+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// Dump writes the configuration last loaded by Load to w in format `yaml`,
+// `toml`, `json` or `env`. Fields tagged with `secret:"true"` and values
+// decrypted from envelopes are written as RedactedPlaceholder
+func (configure *Configure) Dump(w io.Writer, format string) error {
+	return configure.dump(w, format, false)
+}
+
+// DumpWithSources writes the configuration like Dump, with comments telling
+// where each value has been loaded from, see GetSource. Comments are not
+// written in `json`
+func (configure *Configure) DumpWithSources(w io.Writer, format string) error {
+	return configure.dump(w, format, true)
+}
+
+// dump writes the snapshot of the configuration taken when it was loaded, or
+// the configuration if it failed to load, holding the reload lock so that it
+// is never read while being reloaded
+func (configure *Configure) dump(w io.Writer, format string, withSources bool) error {
+	configure.reloadMutex.Lock()
+	defer configure.reloadMutex.Unlock()
+
+	configure.mutex.Lock()
+	config, loadedValue, encrypted := configure.config, configure.loadedValue, configure.encrypted
+	configure.mutex.Unlock()
+
+	if loadedValue.IsValid() {
+		config = loadedValue.Addr().Interface()
+	}
+
+	if config == nil {
+		return errors.New("no configuration has been loaded")
+	}
+	return configure.writeDump(w, config, format, withSources, encrypted)
+}
+
+// writeDump writes config like Dump, values at encrypted paths are redacted
+func (configure *Configure) writeDump(w io.Writer, config interface{}, format string, withSources bool, encrypted map[string]bool) error {
+	var comments func(path string) []string
+	if withSources {
+		comments = func(path string) []string {
+			if source := configure.GetSource(path); source != "" {
+				return []string{"source: " + source}
+			}
+			return nil
+		}
+	}
+
+	value := reflect.ValueOf(config)
+	if format == FormatENV {
+		var buffer bytes.Buffer
+		prefix := configure.getENVPrefix(config)
+		var prefixes []string
+		if prefix != "-" {
+			prefixes = []string{prefix}
+		}
+
+		if err := configure.writeENVFile(&buffer, value, prefixes, "", comments, encrypted); err != nil {
+			return err
+		}
+		_, err := w.Write(buffer.Bytes())
+		return err
+	}
+
+	builder := &documentBuilder{
+		format: format,
+		secret: func(reflect.Value) interface{} {
+			return RedactedPlaceholder
+		},
+		encrypted: func(path string) bool {
+			return isEncrypted(encrypted, path)
+		},
+	}
+	if comments != nil {
+		builder.comments = func(path string, fieldStruct *reflect.StructField) []string {
+			return comments(path)
+		}
+	}
+	nodes, err := builder.build(value, "")
+	if err != nil {
+		return err
+	}
+	return writeDocument(w, nodes, format)
+}
+
+// writeENVFile writes the fields of value as env variables they would be
+// loaded from
+func (configure *Configure) writeENVFile(buffer *bytes.Buffer, value reflect.Value, prefixes []string, path string, comments func(path string) []string, encrypted map[string]bool) error {
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		fieldStruct := value.Type().Field(i)
+		field := value.Field(i)
+		if !field.CanInterface() {
+			continue
+		}
+
+		fieldPath := joinPath(path, fieldStruct.Name)
+
+		for field.Kind() == reflect.Ptr && !field.IsNil() {
+			field = field.Elem()
+		}
+		if field.Kind() == reflect.Ptr {
+			continue
+		}
+
+		secret := fieldStruct.Tag.Get("secret") == "true"
+		switch {
+		case !secret && isNestedStruct(field.Type()):
+			if err := configure.writeENVFile(buffer, field, configure.getPrefixForStruct(prefixes, &fieldStruct), fieldPath, comments, encrypted); err != nil {
+				return err
+			}
+			continue
+		case !secret && field.Kind() == reflect.Slice && isNestedStruct(indirectType(field.Type().Elem())):
+			for idx := 0; idx < field.Len(); idx++ {
+				elemPrefixes := append(configure.getPrefixForStruct(prefixes, &fieldStruct), fmt.Sprint(idx))
+				if err := configure.writeENVFile(buffer, field.Index(idx), elemPrefixes, fmt.Sprintf("%v[%v]", fieldPath, idx), comments, encrypted); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		envNames := configure.getENVNames(prefixes, &fieldStruct)
+		if len(envNames) == 0 {
+			continue
+		}
+
+		text, err := getENVValue(field)
+		if err != nil {
+			return err
+		}
+		// collections are written as a whole, with the secrets they hold
+		if secret || hasSecretFields(field.Type()) || isEncrypted(encrypted, fieldPath) {
+			text = RedactedPlaceholder
+		}
+
+		if comments != nil {
+			writeComments(buffer, comments(fieldPath), "")
+		}
+		fmt.Fprintf(buffer, "%v=%v\n", envNames[len(envNames)-1], quoteENVValue(text))
+	}
+	return nil
+}
+
+// getENVValue formats field as processTags parses env variables
+func getENVValue(field reflect.Value) (string, error) {
+	switch value := field.Interface().(type) {
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case time.Duration:
+		return value.String(), nil
+	}
+
+	data, err := yaml.Marshal(field.Interface())
+	if err != nil {
+		return "", err
+	}
+
+	if field.Kind() == reflect.Slice || field.Kind() == reflect.Array || field.Kind() == reflect.Map {
+		// write collections in the flow style to keep them in one line
+		var node interface{}
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return "", err
+		}
+		if data, err = json.Marshal(normalizeValue(node)); err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+func quoteENVValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\r\n\"'`#$\\=") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// DumpHandler returns a http.Handler serving the configuration like Dump, the
+// format is read from the `format` query parameter and defaults to `yaml`,
+// sources are written if the `sources` query parameter is true
+func (configure *Configure) DumpHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		format := req.URL.Query().Get("format")
+		if format == "" {
+			format = FormatYAML
+		}
+		withSources, _ := strconv.ParseBool(req.URL.Query().Get("sources"))
+
+		switch format {
+		case FormatYAML, FormatTOML, FormatJSON, FormatENV:
+		default:
+			http.Error(w, fmt.Sprintf("unsupported format %v", format), http.StatusBadRequest)
+			return
+		}
+
+		var buffer bytes.Buffer
+		if err := configure.dump(&buffer, format, withSources); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		switch format {
+		case FormatJSON:
+			w.Header().Set("Content-Type", "application/json")
+		default:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		w.Write(buffer.Bytes())
+	})
+}
@@ -0,0 +1,218 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("appname: dump\ndb:\n  password: secret\ncontacts:\n- name: admin\n  email: admin@example.com\n")
+	file.Close()
+
+	os.Setenv("DUMP1_DB_PORT", "5432")
+	defer os.Unsetenv("DUMP1_DB_PORT")
+
+	configure := New(&Config{ENVPrefix: "DUMP1"})
+	if err := configure.Dump(ioutil.Discard, FormatYAML); err == nil {
+		t.Errorf("Dump should return error before loading configuration")
+	}
+
+	var config exampleConfig
+	if err := configure.Load(&config, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, source := range map[string]string{"APPName": "file:" + file.Name(), "Timeout": SourceDefault, "DB.Port": SourceENV, "Contacts[0].Email": "file:" + file.Name()} {
+		if got := configure.GetSource(path); got != source {
+			t.Errorf("source of %v should be %v, but got %v", path, source, got)
+		}
+	}
+
+	for _, format := range []string{FormatYAML, FormatTOML, FormatJSON, FormatENV} {
+		var buffer bytes.Buffer
+		if err := configure.DumpWithSources(&buffer, format); err != nil {
+			t.Errorf("No error should happen when dump %v, but got %v", format, err)
+		}
+
+		if strings.Contains(buffer.String(), "secret") || !strings.Contains(buffer.String(), RedactedPlaceholder) {
+			t.Errorf("%v dump should redact secrets, but got %v", format, buffer.String())
+		}
+
+		if format != FormatJSON && !strings.Contains(buffer.String(), "# source: env") {
+			t.Errorf("%v dump should write sources, but got %v", format, buffer.String())
+		}
+	}
+
+	var buffer bytes.Buffer
+	configure.Dump(&buffer, FormatENV)
+	if want := "DUMP1_APPNAME=dump\nDUMP1_TIMEOUT=5s\nDUMP1_HOSTS=\"[\\\"a\\\",\\\"b\\\"]\"\nDUMP1_DB_NAME=configure\nDUMP1_DB_PASSWORD=<redacted>\nDUMP1_DB_PORT=5432\nDUMP1_CONTACTS_0_NAME=admin\nDUMP1_CONTACTS_0_EMAIL=admin@example.com\n"; buffer.String() != want {
+		t.Errorf("env dump should write env variables, but got %v", buffer.String())
+	}
+}
+
+func TestDumpHandler(t *testing.T) {
+	configure := New(&Config{ENVPrefix: "DUMP2"})
+	var config exampleConfig
+	if err := configure.Load(&config); err == nil {
+		t.Fatal("DB.Password should be required")
+	}
+
+	recorder := httptest.NewRecorder()
+	configure.DumpHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/config?format=json", nil))
+	if recorder.Code != 200 || recorder.Header().Get("Content-Type") != "application/json" || !strings.Contains(recorder.Body.String(), `"APPName": "configure"`) {
+		t.Errorf("handler should serve the configuration, but got %v %v", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	configure.DumpHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/config?format=xml", nil))
+	if recorder.Code != 400 {
+		t.Errorf("handler should reject unsupported formats, but got %v", recorder.Code)
+	}
+}
+
+type mapSecretConfig struct {
+	Databases map[string]struct {
+		Host     string
+		Password string `secret:"true"`
+	}
+}
+
+func TestDumpMapOfStructs(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("databases:\n  primary:\n    host: db1\n    password: hunter2\n")
+	file.Close()
+
+	var (
+		config    mapSecretConfig
+		configure = New(&Config{ENVPrefix: "DUMP3"})
+	)
+	if err := configure.Load(&config, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{FormatYAML, FormatTOML, FormatJSON, FormatENV} {
+		var buffer bytes.Buffer
+		if err := configure.Dump(&buffer, format); err != nil {
+			t.Errorf("No error should happen when dump %v, but got %v", format, err)
+		}
+
+		if strings.Contains(buffer.String(), "hunter2") || !strings.Contains(buffer.String(), RedactedPlaceholder) {
+			t.Errorf("%v dump should redact secrets of map values, but got %v", format, buffer.String())
+		}
+
+		if format == FormatENV {
+			continue
+		}
+
+		var result mapSecretConfig
+		if _, err := decodeFile(&result, "dump."+format, buffer.Bytes(), true); err != nil || result.Databases["primary"].Host != "db1" {
+			t.Errorf("%v dump of map values should be decodable, but got %v, %v", format, err, buffer.String())
+		}
+	}
+}
+
+func TestDumpRedactsDecryptedValues(t *testing.T) {
+	provider := newTestKeyProvider(t, "k1")
+	var envelopes []string
+	for _, value := range []string{"plain-token", "plain-host", "plain-label"} {
+		envelope, err := EncryptValue(provider, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		envelopes = append(envelopes, envelope)
+	}
+
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("token: " + envelopes[0] + "\nhosts: [a, \"" + envelopes[1] + "\"]\nlabels:\n  team: " + envelopes[2] + "\n  tier: web\n")
+	file.Close()
+
+	var config struct {
+		Token  string
+		Hosts  []string
+		Labels map[string]string
+	}
+	configure := New(&Config{ENVPrefix: "DUMP4", KeyProvider: provider})
+	if err := configure.Load(&config, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{FormatYAML, FormatTOML, FormatJSON, FormatENV} {
+		var buffer bytes.Buffer
+		if err := configure.Dump(&buffer, format); err != nil {
+			t.Errorf("No error should happen when dump %v, but got %v", format, err)
+		}
+
+		if dump := buffer.String(); strings.Contains(dump, "plain-") || !strings.Contains(dump, RedactedPlaceholder) || (format != FormatENV && !strings.Contains(dump, "web")) {
+			t.Errorf("values decrypted from envelopes should be redacted in %v, but got %v", format, dump)
+		}
+	}
+}
+
+func TestDumpWhileReloading(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("db:\n  password: secret\n")
+	file.Close()
+
+	var config exampleConfig
+	configure := New(&Config{ENVPrefix: "DUMP5", Silent: true})
+	if err := configure.Load(&config, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			configure.Reload()
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		var buffer bytes.Buffer
+		if err := configure.Dump(&buffer, FormatYAML); err != nil {
+			t.Errorf("No error should happen when dump while reloading, but got %v", err)
+		}
+	}
+	<-done
+}
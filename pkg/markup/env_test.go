@@ -0,0 +1,137 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+type envDBConfig struct {
+	Host       string
+	DBPassword string
+}
+
+type envPrefixConfig struct {
+	Primary envDBConfig `envprefix:"PG_PRIMARY_"`
+	Replica envDBConfig
+	Cache   struct {
+		Host  string
+		Nodes []string
+	} `env:"-"`
+	Secret string `env:"-" default:"default"`
+}
+
+func TestENVPrefixTag(t *testing.T) {
+	os.Setenv("PG_PRIMARY_HOST", "primary")
+	os.Setenv("ENVPREFIX1_REPLICA_HOST", "replica")
+	os.Setenv("ENVPREFIX1_CACHE_HOST", "cache")
+	os.Setenv("ENVPREFIX1_SECRET", "secret")
+	defer os.Unsetenv("PG_PRIMARY_HOST")
+	defer os.Unsetenv("ENVPREFIX1_REPLICA_HOST")
+	defer os.Unsetenv("ENVPREFIX1_CACHE_HOST")
+	defer os.Unsetenv("ENVPREFIX1_SECRET")
+
+	var config envPrefixConfig
+	if err := New(&Config{ENVPrefix: "ENVPREFIX1"}).Load(&config); err != nil {
+		t.Fatalf("No error should happen when load configurations, but got %v", err)
+	}
+
+	if config.Primary.Host != "primary" {
+		t.Errorf("primary host should be loaded from PG_PRIMARY_HOST, but got %v", config.Primary.Host)
+	}
+
+	if config.Replica.Host != "replica" {
+		t.Errorf("replica host should be loaded from ENVPREFIX1_REPLICA_HOST, but got %v", config.Replica.Host)
+	}
+
+	if config.Cache.Host != "" {
+		t.Errorf("cache host shouldn't be loaded from env, but got %v", config.Cache.Host)
+	}
+
+	if config.Secret != "default" {
+		t.Errorf("secret shouldn't be loaded from env, but got %v", config.Secret)
+	}
+
+	if err := New(&Config{ENVPrefix: "ENVPREFIX1", StrictENV: true}).Load(&envPrefixConfig{}); err == nil {
+		t.Errorf("env variables of disabled fields should be reported in strict env mode")
+	}
+}
+
+func TestENVNaming(t *testing.T) {
+	os.Setenv("ENVNAMING1_PRIMARY_DB_PASSWORD", "secret")
+	defer os.Unsetenv("ENVNAMING1_PRIMARY_DB_PASSWORD")
+
+	var config envPrefixConfig
+	if err := New(&Config{ENVPrefix: "ENVNAMING1", ENVNaming: ScreamingSnakeCase}).Load(&config); err != nil {
+		t.Fatalf("No error should happen when load configurations, but got %v", err)
+	}
+
+	if config.Primary.DBPassword != "" {
+		t.Errorf("envprefix tags should replace prefixes, but got %v", config.Primary.DBPassword)
+	}
+
+	os.Setenv("PG_PRIMARY_DB_PASSWORD", "primary")
+	os.Setenv("ENVNAMING1_REPLICA_DB_PASSWORD", "replica")
+	defer os.Unsetenv("PG_PRIMARY_DB_PASSWORD")
+	defer os.Unsetenv("ENVNAMING1_REPLICA_DB_PASSWORD")
+
+	if err := New(&Config{ENVPrefix: "ENVNAMING1", ENVNaming: ScreamingSnakeCase}).Load(&config); err != nil {
+		t.Fatalf("No error should happen when load configurations, but got %v", err)
+	}
+
+	if config.Primary.DBPassword != "primary" || config.Replica.DBPassword != "replica" {
+		t.Errorf("passwords should be loaded from screaming snake case env variables, but got %v, %v", config.Primary.DBPassword, config.Replica.DBPassword)
+	}
+}
+
+func TestScreamingSnakeCase(t *testing.T) {
+	for name, expected := range map[string]string{
+		"DBPassword": "DB_PASSWORD",
+		"APPName":    "APP_NAME",
+		"HTTP2Port":  "HTTP2_PORT",
+		"Host":       "HOST",
+		"userID":     "USER_ID",
+		"DB":         "DB",
+	} {
+		if result := ScreamingSnakeCase(name); result != expected {
+			t.Errorf("%v should be converted to %v, but got %v", name, expected, result)
+		}
+	}
+}
+
+func TestENVReferenceWithPrefixTag(t *testing.T) {
+	references := New(&Config{ENVPrefix: "ENVREF1", ENVNaming: ScreamingSnakeCase}).GetReference(&envPrefixConfig{})
+
+	envs := map[string][]string{}
+	for _, reference := range references {
+		envs[reference.Path] = reference.ENV
+	}
+
+	if !reflect.DeepEqual(envs["Primary.DBPassword"], []string{"PG_PRIMARY_DB_PASSWORD"}) {
+		t.Errorf("reference should list env variables with envprefix, but got %v", envs["Primary.DBPassword"])
+	}
+
+	if len(envs["Cache.Host"]) != 0 || len(envs["Secret"]) != 0 {
+		t.Errorf("reference shouldn't list env variables of disabled fields, but got %v, %v", envs["Cache.Host"], envs["Secret"])
+	}
+}
@@ -0,0 +1,88 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// SecretPlaceholder is written in examples instead of the values of fields
+// tagged with `secret:"true"`
+const SecretPlaceholder = "<secret>"
+
+// WriteExample writes an example configuration file of config to w in format
+// `yaml`, `toml` or `json`, every field is set to its default value, and
+// commented with its `usage` or `doc` tag and whether it is required if the
+// format supports comments. Fields tagged with `secret:"true"` are written as
+// SecretPlaceholder
+func (configure *Configure) WriteExample(w io.Writer, config interface{}, format string) error {
+	configType := reflect.TypeOf(config)
+	for configType != nil && configType.Kind() == reflect.Ptr {
+		configType = configType.Elem()
+	}
+	if configType == nil || configType.Kind() != reflect.Struct {
+		return fmt.Errorf("config should be a struct or a pointer to struct, but got %v", configType)
+	}
+
+	value := reflect.New(configType)
+	if err := configure.processDefaults(value.Interface()); err != nil {
+		return err
+	}
+
+	builder := &documentBuilder{
+		format:   format,
+		comments: getExampleComments,
+		secret: func(reflect.Value) interface{} {
+			return SecretPlaceholder
+		},
+		examples: configure,
+	}
+
+	nodes, err := builder.build(value, "")
+	if err != nil {
+		return err
+	}
+	return writeDocument(w, nodes, format)
+}
+
+// WriteExample writes an example configuration file of config to w, see Configure.WriteExample
+func WriteExample(w io.Writer, config interface{}, format string) error {
+	return New(nil).WriteExample(w, config, format)
+}
+
+func getExampleComments(path string, fieldStruct *reflect.StructField) []string {
+	var comments []string
+	if usage := fieldStruct.Tag.Get("usage"); usage != "" {
+		comments = append(comments, usage)
+	} else if doc := fieldStruct.Tag.Get("doc"); doc != "" {
+		comments = append(comments, doc)
+	}
+
+	if fieldStruct.Tag.Get("required") == "true" {
+		comments = append(comments, "Required")
+	}
+	if message := fieldStruct.Tag.Get("deprecated"); message != "" {
+		comments = append(comments, "Deprecated: "+message)
+	}
+	return comments
+}
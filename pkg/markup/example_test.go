@@ -0,0 +1,97 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type exampleConfig struct {
+	APPName string        `default:"configure" usage:"name of the application"`
+	Timeout time.Duration `default:"5s"`
+	Hosts   []string      `default:"[a,b]"`
+	DB      struct {
+		Name     string `default:"configure"`
+		Password string `secret:"true" required:"true"`
+		Port     uint   `default:"3306"`
+	}
+	Contacts []struct {
+		Name  string `default:"admin"`
+		Email string `default:"admin@example.com"`
+	}
+}
+
+func TestWriteExample(t *testing.T) {
+	for _, format := range []string{FormatYAML, FormatTOML, FormatJSON} {
+		var buffer bytes.Buffer
+		if err := WriteExample(&buffer, &exampleConfig{}, format); err != nil {
+			t.Errorf("No error should happen when write %v example, but got %v", format, err)
+			continue
+		}
+
+		if !strings.Contains(buffer.String(), SecretPlaceholder) {
+			t.Errorf("%v example should write placeholders of secrets, but got %v", format, buffer.String())
+		}
+
+		if format != FormatJSON && (!strings.Contains(buffer.String(), "# name of the application") || !strings.Contains(buffer.String(), "# Required")) {
+			t.Errorf("%v example should write comments, but got %v", format, buffer.String())
+		}
+
+		file, err := ioutil.TempFile("/tmp", "configure.*."+format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		file.Write(buffer.Bytes())
+		file.Close()
+
+		var result exampleConfig
+		if err := New(&Config{ENVPrefix: "EXAMPLE1"}).Load(&result, file.Name()); err != nil {
+			t.Errorf("No error should happen when load %v example, but got %v", format, err)
+		}
+
+		if result.APPName != "configure" || result.Timeout != 5*time.Second || !reflect.DeepEqual(result.Hosts, []string{"a", "b"}) || result.DB.Port != 3306 || result.DB.Password != SecretPlaceholder {
+			t.Errorf("%v example should load default values, but got %+v", format, result)
+		}
+
+		if len(result.Contacts) != 1 || result.Contacts[0].Email != "admin@example.com" {
+			t.Errorf("%v example should write an element of slices, but got %+v", format, result.Contacts)
+		}
+	}
+}
+
+func TestWriteExampleInvalidDefaultOfSliceElement(t *testing.T) {
+	var config struct {
+		Servers []struct {
+			Port int `default:"port"`
+		}
+	}
+
+	if err := New(&Config{ENVPrefix: "EXAMPLE2"}).WriteExample(ioutil.Discard, &config, FormatYAML); err == nil {
+		t.Errorf("Should get error when write example with invalid default values of slice elements")
+	}
+}
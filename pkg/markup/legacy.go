@@ -0,0 +1,187 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Warning describes a problem in configurations that doesn't fail the load,
+// like a deprecated key
+type Warning struct {
+	// File is the configuration file, or empty for env variables
+	File string
+	// Key is the key in File, or the name of the env variable
+	Key     string
+	Message string
+}
+
+func (warning Warning) String() string {
+	if warning.File == "" {
+		return fmt.Sprintf("env %v: %v", warning.Key, warning.Message)
+	}
+	return fmt.Sprintf("%v: %v: %v", warning.File, warning.Key, warning.Message)
+}
+
+// Warnings returns warnings reported while loading configurations
+func (configure *Configure) Warnings() []Warning {
+	configure.mutex.Lock()
+	defer configure.mutex.Unlock()
+	return append([]Warning{}, configure.warnings...)
+}
+
+// warn reports warning once for each file and key
+func (configure *Configure) warn(warning Warning) {
+	configure.mutex.Lock()
+	defer configure.mutex.Unlock()
+
+	for _, w := range configure.warnings {
+		if w.File == warning.File && w.Key == warning.Key {
+			return
+		}
+	}
+	configure.warnings = append(configure.warnings, warning)
+
+	fields := Fields{"key": warning.Key, "message": warning.Message}
+	if warning.File != "" {
+		fields["file"] = warning.File
+	}
+	configure.log(LevelWarn, "Deprecated configuration", fields)
+}
+
+var legacyTagsCache sync.Map // map[reflect.Type]bool
+
+// hasLegacyTags reports whether t, or any struct nested in it, has fields
+// tagged with `aliases` or `deprecated`
+func hasLegacyTags(t reflect.Type) bool {
+	if result, ok := legacyTagsCache.Load(t); ok {
+		return result.(bool)
+	}
+	result := findLegacyTags(t, map[reflect.Type]bool{})
+	legacyTagsCache.Store(t, result)
+	return result
+}
+
+func findLegacyTags(t reflect.Type, visited map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct || visited[t] {
+		return false
+	}
+	visited[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		fieldStruct := t.Field(i)
+		if fieldStruct.Tag.Get("aliases") != "" || fieldStruct.Tag.Get("deprecated") != "" {
+			return true
+		}
+		if findLegacyTags(fieldStruct.Type, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+func getAliases(fieldStruct *reflect.StructField) []string {
+	var aliases []string
+	for _, alias := range strings.Split(fieldStruct.Tag.Get("aliases"), ",") {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+// processLegacyKeys moves values of aliased keys in doc to the keys of their
+// fields, and reports deprecated keys. Changes are appended to edits, with
+// the keys of doc in the document tree
+func (configure *Configure) processLegacyKeys(file string, t reflect.Type, doc map[string]interface{}, format string, keys []interface{}, edits *[]documentEdit) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	path := documentPath(keys)
+	for i := 0; i < t.NumField(); i++ {
+		fieldStruct := t.Field(i)
+		if fieldStruct.PkgPath != "" {
+			continue
+		}
+
+		key, inline := documentKey(&fieldStruct, format)
+		if inline {
+			configure.processLegacyKeys(file, fieldStruct.Type, doc, format, keys, edits)
+			continue
+		} else if key == "-" {
+			continue
+		}
+
+		for _, alias := range getAliases(&fieldStruct) {
+			aliasKey, ok := findDocumentKey(doc, alias, format)
+			if !ok {
+				continue
+			}
+
+			if _, ok := findDocumentKey(doc, key, format); ok {
+				configure.warn(Warning{File: file, Key: joinPath(path, aliasKey), Message: fmt.Sprintf("ignored, as %v is set too", joinPath(path, key))})
+				*edits = append(*edits, documentEdit{keys: appendKey(keys, aliasKey), delete: true})
+			} else {
+				configure.warn(Warning{File: file, Key: joinPath(path, aliasKey), Message: fmt.Sprintf("renamed, use %v instead", joinPath(path, key))})
+				doc[key] = doc[aliasKey]
+				*edits = append(*edits, documentEdit{keys: appendKey(keys, aliasKey), rename: key})
+			}
+			delete(doc, aliasKey)
+		}
+
+		docKey, ok := findDocumentKey(doc, key, format)
+		if !ok {
+			continue
+		}
+
+		if message := fieldStruct.Tag.Get("deprecated"); message != "" {
+			configure.warn(Warning{File: file, Key: joinPath(path, docKey), Message: message})
+		}
+
+		fieldType := fieldStruct.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		switch fieldType.Kind() {
+		case reflect.Struct:
+			if m, ok := doc[docKey].(map[string]interface{}); ok {
+				configure.processLegacyKeys(file, fieldType, m, format, appendKey(keys, docKey), edits)
+			}
+		case reflect.Slice, reflect.Array:
+			for idx, m := range documentList(doc[docKey]) {
+				configure.processLegacyKeys(file, fieldType.Elem(), m, format, appendKey(appendKey(keys, docKey), idx), edits)
+			}
+		}
+	}
+}
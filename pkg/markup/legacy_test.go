@@ -0,0 +1,144 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+type legacyConfig struct {
+	DB struct {
+		PoolSize int    `aliases:"pool,max_connections"`
+		Timeout  int    `deprecated:"use db.pool_timeout instead"`
+		Name     string `aliases:"database"`
+	}
+}
+
+func TestLoadAliasedAndDeprecatedKeys(t *testing.T) {
+	for _, ext := range []string{".yml", ".json", ".toml"} {
+		file, err := ioutil.TempFile("/tmp", "bhojpur*"+ext)
+		if err != nil {
+			t.Fatal("Could not create temp file")
+		}
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		switch ext {
+		case ".yml":
+			file.WriteString("db:\n  pool: 10\n  timeout: 5\n")
+		case ".json":
+			file.WriteString(`{"DB": {"pool": 10, "Timeout": 5}}`)
+		case ".toml":
+			file.WriteString("[DB]\npool = 10\nTimeout = 5\n")
+		}
+
+		var (
+			result    legacyConfig
+			configure = New(&Config{ENVPrefix: "LEGACY1", ErrorOnUnmatchedKeys: true, Silent: true})
+		)
+		if err := configure.Load(&result, file.Name()); err != nil {
+			t.Fatalf("No error should happen when load %v configurations, but got %v", ext, err)
+		}
+
+		if result.DB.PoolSize != 10 || result.DB.Timeout != 5 {
+			t.Errorf("aliased key should be loaded from %v, but got %+v", ext, result)
+		}
+
+		warnings := configure.Warnings()
+		if len(warnings) != 2 || warnings[0].File != file.Name() || warnings[1].Message != "use db.pool_timeout instead" {
+			t.Errorf("should get warnings for the aliased and deprecated keys of %v, but got %+v", ext, warnings)
+		}
+
+		configure.Load(&result, file.Name())
+		if len(configure.Warnings()) != 2 {
+			t.Errorf("each legacy key should be reported once, but got %+v", configure.Warnings())
+		}
+	}
+}
+
+func TestLoadAliasedENV(t *testing.T) {
+	os.Setenv("LEGACY2_DB_DATABASE", "legacy")
+	defer os.Unsetenv("LEGACY2_DB_DATABASE")
+
+	var (
+		result    legacyConfig
+		configure = New(&Config{ENVPrefix: "LEGACY2", Silent: true})
+	)
+	if err := configure.Load(&result); err != nil {
+		t.Fatalf("No error should happen when load configurations, but got %v", err)
+	}
+
+	if result.DB.Name != "legacy" {
+		t.Errorf("aliased env should be loaded, but got %+v", result)
+	}
+
+	if warnings := configure.Warnings(); len(warnings) != 1 || warnings[0].Key != "LEGACY2_DB_DATABASE" || warnings[0].Message != "renamed, use LEGACY2_DB_NAME instead" {
+		t.Errorf("should get warning for the aliased env, but got %+v", warnings)
+	}
+}
+
+type legacyIDConfig struct {
+	ID   uint64 `aliases:"identifier"`
+	Size uint64
+}
+
+func TestLoadAliasedKeysKeepsNumbers(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "bhojpur*.json")
+	if err != nil {
+		t.Fatal("Could not create temp file")
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`{"identifier": 9007199254740993, "Size": 18446744073709551615}`)
+	file.Close()
+
+	var result legacyIDConfig
+	if err := New(&Config{ENVPrefix: "LEGACY3", Silent: true}).Load(&result, file.Name()); err != nil {
+		t.Fatalf("No error should happen when load configurations, but got %v", err)
+	}
+
+	if result.ID != 9007199254740993 || result.Size != 18446744073709551615 {
+		t.Errorf("large integers should be loaded as they are, but got %+v", result)
+	}
+}
+
+func TestProcessDocumentKeepsYAMLComments(t *testing.T) {
+	var (
+		configure = New(&Config{Silent: true})
+		data      = []byte("# database\ndb:\n  pool: 10 # connections\n  name: app\n")
+	)
+
+	result, _, err := configure.processDocument(&legacyConfig{}, "config.yml", data)
+	if err != nil {
+		t.Fatalf("No error should happen when process document, but got %v", err)
+	}
+
+	if text := string(result); !strings.Contains(text, "# database") || !strings.Contains(text, "poolsize: 10 # connections") {
+		t.Errorf("comments should be kept when renaming keys, but got %v", text)
+	}
+
+	data = []byte("# database\ndb:\n  poolsize: 10\n")
+	if result, _, err := configure.processDocument(&legacyConfig{}, "config.yml", data); err != nil || string(result) != string(data) {
+		t.Errorf("documents without keys to change shouldn't be rewritten, but got %s", result)
+	}
+}
@@ -0,0 +1,160 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Level is the level of log events
+type Level int
+
+// Levels of log events, Verbose mode logs trace events, Debug mode logs debug
+// events, Silent mode only logs errors, info events are logged otherwise
+const (
+	LevelTrace Level = iota
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (level Level) String() string {
+	switch level {
+	case LevelTrace:
+		return "trace"
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(level))
+}
+
+// Fields are the structured data of log events, e.g. the file being loaded
+type Fields map[string]interface{}
+
+// Logger logs events of configure, events below the level of Silent, Debug
+// or Verbose mode are not logged
+type Logger interface {
+	Log(level Level, msg string, fields Fields)
+}
+
+// LoggerFunc is a function used as Logger
+type LoggerFunc func(level Level, msg string, fields Fields)
+
+// Log calls fn
+func (fn LoggerFunc) Log(level Level, msg string, fields Fields) {
+	fn(level, msg, fields)
+}
+
+// NewTextLogger returns a Logger writing events as lines like
+// `level=warn msg="Failed to find configuration" file=config.yml` to w
+func NewTextLogger(w io.Writer) Logger {
+	var mutex sync.Mutex
+	return LoggerFunc(func(level Level, msg string, fields Fields) {
+		var b strings.Builder
+		fmt.Fprintf(&b, "level=%v msg=%q", level, msg)
+
+		var keys []string
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			value := fmt.Sprint(fields[key])
+			if strings.ContainsAny(value, " \t\n\"=") || value == "" {
+				value = fmt.Sprintf("%q", value)
+			}
+			fmt.Fprintf(&b, " %v=%v", key, value)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		fmt.Fprintln(w, b.String())
+	})
+}
+
+// NewLogrusLogger returns a Logger logging events with logger, fields are
+// logged as logrus fields
+func NewLogrusLogger(logger logrus.FieldLogger) Logger {
+	return LoggerFunc(func(level Level, msg string, fields Fields) {
+		entry := logger.WithFields(logrus.Fields(fields))
+		switch level {
+		case LevelTrace:
+			entry.Trace(msg)
+		case LevelDebug:
+			entry.Debug(msg)
+		case LevelInfo:
+			entry.Info(msg)
+		case LevelWarn:
+			entry.Warn(msg)
+		default:
+			entry.Error(msg)
+		}
+	})
+}
+
+// defaultLogger writes events to stderr, so that they don't mix with the
+// output of programs
+var defaultLogger = NewTextLogger(os.Stderr)
+
+// getLogLevel returns the lowest level of logged events
+func (configure *Configure) getLogLevel() Level {
+	switch {
+	case configure.Config.Verbose:
+		return LevelTrace
+	case configure.Config.Debug:
+		return LevelDebug
+	case configure.Config.Silent:
+		return LevelError
+	}
+	return LevelInfo
+}
+
+// isLogged reports whether events of level are logged
+func (configure *Configure) isLogged(level Level) bool {
+	return level >= configure.getLogLevel()
+}
+
+func (configure *Configure) log(level Level, msg string, fields Fields) {
+	if !configure.isLogged(level) {
+		return
+	}
+
+	if configure.Config.Logger != nil {
+		configure.Config.Logger.Log(level, msg, fields)
+	} else {
+		defaultLogger.Log(level, msg, fields)
+	}
+}
@@ -0,0 +1,122 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+type logEvent struct {
+	level  Level
+	msg    string
+	fields Fields
+}
+
+func TestLogger(t *testing.T) {
+	for _, test := range []struct {
+		config *Config
+		events []string
+	}{
+		{&Config{ENVPrefix: "LOG1", Silent: true}, nil},
+		{&Config{ENVPrefix: "LOG1"}, []string{"Failed to find configuration"}},
+		{&Config{ENVPrefix: "LOG1", Debug: true}, []string{"Current environment", "Failed to find configuration", "Loading field from env", "Configuration loaded"}},
+	} {
+		var events []logEvent
+		test.config.Logger = LoggerFunc(func(level Level, msg string, fields Fields) {
+			events = append(events, logEvent{level, msg, fields})
+		})
+
+		os.Setenv("LOG1_APPNAME", "logger")
+		var config struct{ APPName string }
+		New(test.config).Load(&config, "/tmp/configure-missing.yml")
+		os.Unsetenv("LOG1_APPNAME")
+
+		var msgs []string
+		for _, event := range events {
+			msgs = append(msgs, event.msg)
+		}
+
+		if strings.Join(msgs, ", ") != strings.Join(test.events, ", ") {
+			t.Errorf("%+v should log %v, but got %v", test.config, test.events, msgs)
+		}
+
+		for _, event := range events {
+			if event.msg == "Failed to find configuration" && (event.level != LevelWarn || event.fields["file"] != "/tmp/configure-missing.yml") {
+				t.Errorf("events should have levels and fields, but got %+v", event)
+			}
+		}
+	}
+}
+
+func TestLogrusLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &buffer
+	logger.Formatter = &logrus.JSONFormatter{}
+
+	var config struct{ APPName string }
+	New(&Config{ENVPrefix: "LOG2", Logger: NewLogrusLogger(logger)}).Load(&config, "/tmp/configure-missing.yml")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &entry); err != nil {
+		t.Fatalf("logrus should log json, but got %v", buffer.String())
+	}
+
+	if entry["level"] != "warning" || entry["msg"] != "Failed to find configuration" || entry["file"] != "/tmp/configure-missing.yml" {
+		t.Errorf("logrus should log events with their fields, but got %v", entry)
+	}
+}
+
+func TestLogrusLoggerLevels(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &buffer
+	logger.Formatter = &logrus.JSONFormatter{}
+	logger.Level = logrus.DebugLevel
+
+	NewLogrusLogger(logger).Log(LevelTrace, "Loading configuration", nil)
+	if buffer.Len() != 0 {
+		t.Errorf("trace events should not be logged at debug level, but got %v", buffer.String())
+	}
+
+	logger.Level = logrus.TraceLevel
+	NewLogrusLogger(logger).Log(LevelTrace, "Loading configuration", nil)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &entry); err != nil || entry["level"] != "trace" {
+		t.Errorf("trace events should be logged at trace level, but got %v", buffer.String())
+	}
+}
+
+func TestTextLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	NewTextLogger(&buffer).Log(LevelWarn, "Failed to find configuration", Fields{"file": "config.yml", "error": "not found"})
+
+	if want := "level=warn msg=\"Failed to find configuration\" error=\"not found\" file=config.yml\n"; buffer.String() != want {
+		t.Errorf("text logger should write %v, but got %v", want, buffer.String())
+	}
+}
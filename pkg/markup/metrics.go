@@ -0,0 +1,196 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Metrics are the counters and timestamps of the loads of a configuration
+type Metrics struct {
+	// Loads counts calls of Load
+	Loads uint64 `json:"loads"`
+	// Reloads counts reloads of changed files, Reload calls and overrides
+	Reloads uint64 `json:"reloads"`
+	// Failures counts loads and reloads that returned errors
+	Failures    uint64     `json:"failures"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastFailure *time.Time `json:"last_failure,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	// OverrideFailures counts overrides rejected because the configuration
+	// failed to reload with them, the running configuration is kept
+	OverrideFailures    uint64     `json:"override_failures"`
+	LastOverrideFailure *time.Time `json:"last_override_failure,omitempty"`
+	LastOverrideError   string     `json:"last_override_error,omitempty"`
+	// Hash is the sha256 hash of the active configuration, written without
+	// secret fields and values decrypted from envelopes, so it doesn't change
+	// if only they change
+	Hash        string   `json:"hash"`
+	Files       []string `json:"files"`
+	Environment string   `json:"environment"`
+}
+
+// recordLoad updates metrics with the result of a load or reload of config,
+// failures of reloads with a new override are recorded apart
+func (configure *Configure) recordLoad(reload, override bool, config interface{}, err error) {
+	var hash string
+	if err == nil {
+		hash = configure.hashConfig(config)
+	}
+
+	configure.mutex.Lock()
+	defer configure.mutex.Unlock()
+
+	if reload {
+		configure.metrics.Reloads++
+	} else {
+		configure.metrics.Loads++
+	}
+
+	now := time.Now()
+	if err != nil && override {
+		configure.metrics.OverrideFailures++
+		configure.metrics.LastOverrideFailure = &now
+		configure.metrics.LastOverrideError = err.Error()
+		return
+	}
+
+	if err != nil {
+		configure.metrics.Failures++
+		configure.metrics.LastFailure = &now
+		configure.metrics.LastError = err.Error()
+		return
+	}
+
+	configure.metrics.LastSuccess = &now
+	configure.metrics.Hash = hash
+}
+
+// hashConfig returns the sha256 hash of config written like Dump in json, so
+// that the values of secret fields can't be guessed from it
+func (configure *Configure) hashConfig(config interface{}) string {
+	configure.mutex.Lock()
+	encrypted := configure.encrypted
+	configure.mutex.Unlock()
+
+	var buffer bytes.Buffer
+	if err := configure.writeDump(&buffer, config, FormatJSON, false, encrypted); err != nil {
+		buffer.Reset()
+		fmt.Fprintf(&buffer, "%#v", err)
+	}
+
+	sum := sha256.Sum256(buffer.Bytes())
+	return hex.EncodeToString(sum[:])
+}
+
+// Metrics returns the counters and timestamps of the loads of the
+// configuration, and the files and environment it has been loaded from
+func (configure *Configure) Metrics() Metrics {
+	environment := configure.GetEnvironment()
+
+	configure.mutex.Lock()
+	defer configure.mutex.Unlock()
+
+	metrics := configure.metrics
+	metrics.Files = append([]string{}, configure.activeFiles...)
+	metrics.Environment = environment
+	return metrics
+}
+
+// PublishExpvar publishes Metrics as the expvar variable name, it panics if
+// name is already published, like expvar.Publish
+func (configure *Configure) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return configure.Metrics()
+	}))
+}
+
+// WritePrometheus writes Metrics to w in the Prometheus text format
+func (configure *Configure) WritePrometheus(w io.Writer) error {
+	metrics := configure.Metrics()
+
+	var b strings.Builder
+	writeMetric := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(&b, "# HELP %v %v\n# TYPE %v %v\n%v %v\n", name, help, name, kind, name, value)
+	}
+
+	writeMetric("configure_loads_total", "counter", "Number of configuration loads.", metrics.Loads)
+	writeMetric("configure_reloads_total", "counter", "Number of configuration reloads.", metrics.Reloads)
+	writeMetric("configure_failures_total", "counter", "Number of failed configuration loads and reloads.", metrics.Failures)
+	writeMetric("configure_last_success_timestamp_seconds", "gauge", "Time of the last successful configuration load.", unixSeconds(metrics.LastSuccess))
+	writeMetric("configure_last_failure_timestamp_seconds", "gauge", "Time of the last failed configuration load.", unixSeconds(metrics.LastFailure))
+
+	fmt.Fprintf(&b, "# HELP configure_info Active configuration.\n# TYPE configure_info gauge\n")
+	fmt.Fprintf(&b, "configure_info{environment=\"%v\",hash=\"%v\"} 1\n", labelReplacer.Replace(metrics.Environment), labelReplacer.Replace(metrics.Hash))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// labelReplacer escapes label values in the Prometheus text format
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func unixSeconds(t *time.Time) float64 {
+	if t == nil {
+		return 0
+	}
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// MetricsHandler returns a http.Handler serving Metrics in the Prometheus
+// text format
+func (configure *Configure) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		configure.WritePrometheus(w)
+	})
+}
+
+// StatusHandler returns a http.Handler serving Metrics as json, with the
+// active files and environment, it responds with 503 Service Unavailable if
+// the last load or reload failed. Rejected overrides are reported in the body
+// only, as the running configuration is kept. The hash doesn't change if only
+// secret fields or values decrypted from envelopes change
+func (configure *Configure) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		metrics := configure.Metrics()
+
+		code := http.StatusOK
+		if metrics.LastFailure != nil && (metrics.LastSuccess == nil || metrics.LastFailure.After(*metrics.LastSuccess)) {
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(metrics)
+	})
+}
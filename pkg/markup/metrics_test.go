@@ -0,0 +1,149 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("db:\n  password: secret\n")
+	file.Close()
+
+	configure := New(&Config{ENVPrefix: "METRICS1", Environment: "production"})
+	var config exampleConfig
+	if err := configure.Load(&config, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := configure.Metrics()
+	if metrics.Loads != 1 || metrics.Failures != 0 || metrics.LastSuccess == nil || metrics.LastFailure != nil || metrics.Hash == "" || metrics.Environment != "production" || len(metrics.Files) != 1 || metrics.Files[0] != file.Name() {
+		t.Errorf("metrics should record loads, but got %+v", metrics)
+	}
+
+	hash := metrics.Hash
+	ioutil.WriteFile(file.Name(), []byte("db:\n  password: changed\n"), 0644)
+	if err := configure.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if metrics = configure.Metrics(); metrics.Hash != hash {
+		t.Errorf("hash should not depend on secret fields, but got %v", metrics.Hash)
+	}
+
+	ioutil.WriteFile(file.Name(), []byte("db:\n  name: changed\n  password: changed\n"), 0644)
+	if err := configure.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if metrics = configure.Metrics(); metrics.Hash == hash {
+		t.Errorf("hash should change with the configuration, but got %v", metrics.Hash)
+	}
+
+	hash = metrics.Hash
+	envFile := strings.TrimSuffix(file.Name(), ".yml") + ".production.yml"
+	defer os.Remove(envFile)
+	ioutil.WriteFile(envFile, []byte("db:\n  password: \"\"\n"), 0644)
+	configure.Reload()
+
+	metrics = configure.Metrics()
+	if metrics.Reloads != 3 || metrics.Failures != 1 || metrics.Hash != hash || !strings.Contains(metrics.LastError, "Password is required") {
+		t.Errorf("metrics should record reloads and failures, but got %+v", metrics)
+	}
+
+	if len(metrics.Files) != 1 || metrics.Files[0] != file.Name() {
+		t.Errorf("failed reloads should keep the active files, but got %v", metrics.Files)
+	}
+
+	var buffer bytes.Buffer
+	configure.WritePrometheus(&buffer)
+	for _, line := range []string{"configure_loads_total 1\n", "configure_reloads_total 3\n", "configure_failures_total 1\n", `configure_info{environment="production",hash="` + metrics.Hash + `"} 1`} {
+		if !strings.Contains(buffer.String(), line) {
+			t.Errorf("prometheus metrics should contain %v, but got %v", line, buffer.String())
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	configure.StatusHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/status", nil))
+
+	var status Metrics
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil || recorder.Code != 503 || status.Failures != 1 || status.Files[0] != file.Name() {
+		t.Errorf("status handler should serve metrics with 503 after failures, but got %v %v", recorder.Code, recorder.Body.String())
+	}
+
+	if strings.Contains(recorder.Body.String(), `"last_override_failure"`) {
+		t.Errorf("status should omit blank timestamps, but got %v", recorder.Body.String())
+	}
+
+	configure.PublishExpvar("configure_metrics_test")
+	if value := expvar.Get("configure_metrics_test"); value == nil || !strings.Contains(value.String(), `"reloads":3`) {
+		t.Errorf("metrics should be published with expvar, but got %v", value)
+	}
+}
+
+func TestMetricsOverrideFailure(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("db:\n  password: secret\n")
+	file.Close()
+
+	configure := New(&Config{ENVPrefix: "METRICS2", Environment: "prod\"uction\\\n"})
+	var config exampleConfig
+	if err := configure.Load(&config, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := configure.Set("DB.Password", ""); err == nil {
+		t.Errorf("override blanking a required field should be rejected")
+	}
+
+	metrics := configure.Metrics()
+	if metrics.Failures != 0 || metrics.LastFailure != nil || metrics.OverrideFailures != 1 || metrics.LastOverrideFailure == nil || metrics.LastOverrideError == "" {
+		t.Errorf("metrics should record rejected overrides apart from failures, but got %+v", metrics)
+	}
+
+	recorder := httptest.NewRecorder()
+	configure.StatusHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/status", nil))
+	if recorder.Code != 200 || !strings.Contains(recorder.Body.String(), `"override_failures": 1`) || strings.Contains(recorder.Body.String(), `"last_failure"`) {
+		t.Errorf("status handler should report rejected overrides with 200, but got %v %v", recorder.Code, recorder.Body.String())
+	}
+
+	var buffer bytes.Buffer
+	configure.WritePrometheus(&buffer)
+	if line := `configure_info{environment="prod\"uction\\\n",hash="` + metrics.Hash + `"} 1`; !strings.Contains(buffer.String(), line) {
+		t.Errorf("prometheus metrics should contain %v, but got %v", line, buffer.String())
+	}
+}
@@ -0,0 +1,160 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// VersionKey is the top level key holding the version of a configuration document
+const VersionKey = "version"
+
+// Migration transforms a generic configuration document from one version to
+// the next, numbers of JSON documents are json.Number
+type Migration func(doc map[string]interface{}) error
+
+// RegisterMigration registers migration to upgrade documents of version from
+// to version from+1. Documents are migrated to the latest version before they
+// are decoded, documents without a version key are considered to be of the
+// lowest registered version
+func (configure *Configure) RegisterMigration(from int, migration Migration) {
+	configure.mutex.Lock()
+	defer configure.mutex.Unlock()
+
+	if configure.migrations == nil {
+		configure.migrations = map[int]Migration{}
+	}
+	configure.migrations[from] = migration
+}
+
+func (configure *Configure) hasMigrations() bool {
+	configure.mutex.Lock()
+	defer configure.mutex.Unlock()
+	return len(configure.migrations) > 0
+}
+
+// migrateDocument upgrades doc to the latest registered version, and returns
+// whether it has been changed. The version key is written only if doc had it,
+// configType is nil or configType declares it, so that migrated documents
+// don't hold keys unmatched by the config struct
+func (configure *Configure) migrateDocument(file string, configType reflect.Type, doc map[string]interface{}, format string) (bool, error) {
+	configure.mutex.Lock()
+	var versions []int
+	migrations := map[int]Migration{}
+	for version, migration := range configure.migrations {
+		versions = append(versions, version)
+		migrations[version] = migration
+	}
+	configure.mutex.Unlock()
+
+	if len(versions) == 0 {
+		return false, nil
+	}
+	sort.Ints(versions)
+
+	key, ok := findDocumentKey(doc, VersionKey, format)
+	version, latest := versions[0], versions[len(versions)-1]+1
+	if ok {
+		var err error
+		if version, err = getDocumentVersion(doc[key]); err != nil {
+			return false, fmt.Errorf("%v: %v", file, err)
+		}
+	} else {
+		key = VersionKey
+	}
+	writeVersion := ok || configType == nil || documentFieldType(configType, key, format) != nil
+
+	if version > latest {
+		return false, fmt.Errorf("%v: version %v is newer than the latest supported version %v", file, version, latest)
+	}
+
+	var migrated bool
+	for ; version < latest; version++ {
+		migration, ok := migrations[version]
+		if !ok {
+			return false, fmt.Errorf("%v: no migration registered from version %v", file, version)
+		}
+		if err := migration(doc); err != nil {
+			return false, fmt.Errorf("%v: failed to migrate from version %v, got %v", file, version, err)
+		}
+		if writeVersion {
+			doc[key] = version + 1
+		}
+		migrated = true
+	}
+	return migrated, nil
+}
+
+func getDocumentVersion(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v == math.Trunc(v) {
+			return int(v), nil
+		}
+	case json.Number:
+		if version, err := strconv.Atoi(v.String()); err == nil {
+			return version, nil
+		}
+	case string:
+		if version, err := strconv.Atoi(v); err == nil {
+			return version, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid %v %v, it should be an integer", VersionKey, value)
+}
+
+// Migrate upgrades file to the latest registered version, and writes the
+// migrated document to w in the format of file
+func (configure *Configure) Migrate(file string, w io.Writer) error {
+	data, err := configure.readFile(file)
+	if err != nil {
+		return err
+	}
+
+	format := getFileFormat(file)
+	if format == "" {
+		format = detectFormat(data)
+	}
+
+	doc, err := decodeDocument(data, format)
+	if err != nil {
+		return newDecodeError(file, data, format, err)
+	}
+
+	if _, err := configure.migrateDocument(file, nil, doc, format); err != nil {
+		return err
+	}
+
+	if data, err = encodeDocument(doc, format); err == nil {
+		_, err = w.Write(data)
+	}
+	return err
+}
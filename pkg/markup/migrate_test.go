@@ -0,0 +1,140 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+type versionedConfig struct {
+	Version int
+	DB      struct {
+		Host string
+		Port int
+	}
+}
+
+func newVersionedConfigure() *Configure {
+	configure := New(&Config{ENVPrefix: "MIGRATE1", Silent: true})
+	// version 1 kept the database address in a single `db_addr` key
+	configure.RegisterMigration(1, func(doc map[string]interface{}) error {
+		addr, _ := doc["db_addr"].(string)
+		parts := strings.SplitN(addr, ":", 2)
+		doc["db"] = map[string]interface{}{"host": parts[0]}
+		delete(doc, "db_addr")
+		return nil
+	})
+	// version 2 didn't set the port
+	configure.RegisterMigration(2, func(doc map[string]interface{}) error {
+		doc["db"].(map[string]interface{})["port"] = 5432
+		return nil
+	})
+	return configure
+}
+
+func TestLoadMigratedConfig(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "bhojpur*.yml")
+	if err != nil {
+		t.Fatal("Could not create temp file")
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	file.WriteString("db_addr: db.bhojpur.net:5432\n")
+
+	var result versionedConfig
+	if err := newVersionedConfigure().Load(&result, file.Name()); err != nil {
+		t.Fatalf("No error should happen when load configurations, but got %v", err)
+	}
+
+	if result.Version != 3 || result.DB.Host != "db.bhojpur.net" || result.DB.Port != 5432 {
+		t.Errorf("configuration should be migrated to version 3, but got %+v", result)
+	}
+
+	ioutil.WriteFile(file.Name(), []byte("version: 4\n"), 0644)
+	if err := newVersionedConfigure().Load(&result, file.Name()); err == nil {
+		t.Errorf("Should get error when load configuration newer than the latest version")
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "bhojpur*.json")
+	if err != nil {
+		t.Fatal("Could not create temp file")
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	file.WriteString(`{"version": 2, "db": {"host": "localhost"}}`)
+
+	var buffer bytes.Buffer
+	if err := newVersionedConfigure().Migrate(file.Name(), &buffer); err != nil {
+		t.Fatalf("No error should happen when migrate configurations, but got %v", err)
+	}
+
+	want := "{\n  \"db\": {\n    \"host\": \"localhost\",\n    \"port\": 5432\n  },\n  \"version\": 3\n}"
+	if buffer.String() != want {
+		t.Errorf("migrated document should be written as json, but got %v", buffer.String())
+	}
+}
+
+func TestLoadMigratedConfigWithoutVersionField(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "bhojpur*.yml")
+	if err != nil {
+		t.Fatal("Could not create temp file")
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	file.WriteString("db_addr: db.bhojpur.net:5432\n")
+
+	var result struct {
+		DB struct {
+			Host string
+			Port int
+		}
+	}
+	configure := newVersionedConfigure()
+	configure.ErrorOnUnmatchedKeys = true
+	if err := configure.Load(&result, file.Name()); err != nil {
+		t.Fatalf("No error should happen when load configurations without version field, but got %v", err)
+	}
+
+	if result.DB.Host != "db.bhojpur.net" || result.DB.Port != 5432 {
+		t.Errorf("configuration should be migrated, but got %+v", result)
+	}
+}
+
+func TestLoadMigratedConfigWithFractionalVersion(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "bhojpur*.yml")
+	if err != nil {
+		t.Fatal("Could not create temp file")
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	file.WriteString("version: 1.5\ndb_addr: db.bhojpur.net:5432\n")
+
+	var result versionedConfig
+	if err := newVersionedConfigure().Load(&result, file.Name()); err == nil || !strings.Contains(err.Error(), "should be an integer") {
+		t.Errorf("Should get error when load configuration with a fractional version, but got %v", err)
+	}
+}
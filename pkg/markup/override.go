@@ -0,0 +1,366 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// override is a value set with Set, it expires at Expires unless it is zero
+type override struct {
+	Value   interface{} `json:"value"`
+	Expires time.Time   `json:"expires,omitempty"`
+}
+
+func (o override) isExpired(now time.Time) bool {
+	return !o.Expires.IsZero() && !now.Before(o.Expires)
+}
+
+// Set overrides the field at path of the loaded configuration with value,
+// over defaults, files and env. Path is like `DB.Name` or `Contacts[0].Email`,
+// names are matched case insensitively with field names or their keys in
+// files. Value is converted to the type of the field, strings are parsed like
+// env variables. The configuration is reloaded, validated and subscribers are
+// notified of the changes, and the override is persisted to OverrideFile if it
+// is set
+func (configure *Configure) Set(path string, value interface{}) error {
+	return configure.setOverride(path, override{Value: value})
+}
+
+// SetWithTTL overrides the field at path like Set, the override is removed
+// after ttl
+func (configure *Configure) SetWithTTL(path string, value interface{}, ttl time.Duration) error {
+	return configure.setOverride(path, override{Value: value, Expires: time.Now().Add(ttl)})
+}
+
+// Unset removes the override of the field at path set with Set, and reloads
+// the configuration
+func (configure *Configure) Unset(path string) error {
+	return configure.setOverride(path, override{})
+}
+
+// Overrides returns the values set with Set, by their paths
+func (configure *Configure) Overrides() map[string]interface{} {
+	configure.mutex.Lock()
+	defer configure.mutex.Unlock()
+
+	results := map[string]interface{}{}
+	for path, override := range configure.overrides {
+		results[path] = override.Value
+	}
+	return results
+}
+
+// setOverride reloads the configuration with the override of path, an
+// override without value removes it. The previous overrides are restored if
+// the configuration can't be loaded with it
+func (configure *Configure) setOverride(path string, value override) error {
+	configure.mutex.Lock()
+	config := configure.config
+	configure.mutex.Unlock()
+
+	if config == nil {
+		return errors.New("no configuration has been loaded")
+	}
+
+	// validate path and value with a copy of the configuration
+	fieldPath, _, err := setPath(cloneValue(reflect.ValueOf(config).Elem()), path, value.Value, false)
+	if err != nil {
+		return err
+	}
+	path = fieldPath
+
+	configure.mutex.Lock()
+	previous := configure.overrides
+	overrides := map[string]override{}
+	for key, override := range previous {
+		overrides[key] = override
+	}
+	if value.Value == nil {
+		delete(overrides, path)
+	} else {
+		overrides[path] = value
+	}
+	configure.overrides = overrides
+	configure.mutex.Unlock()
+
+	if err := configure.forceReload(true); err != nil {
+		configure.mutex.Lock()
+		configure.overrides = previous
+		configure.mutex.Unlock()
+		return err
+	}
+
+	if !value.Expires.IsZero() {
+		configure.scheduleExpiration(path, value.Expires)
+	}
+	return configure.saveOverrides()
+}
+
+// scheduleExpiration unsets the override of path at expires, unless it has
+// been replaced
+func (configure *Configure) scheduleExpiration(path string, expires time.Time) {
+	time.AfterFunc(time.Until(expires), func() {
+		configure.mutex.Lock()
+		current, ok := configure.overrides[path]
+		configure.mutex.Unlock()
+
+		if ok && current.Expires.Equal(expires) {
+			if err := configure.Unset(path); err != nil {
+				configure.log(LevelError, "Failed to remove expired override", Fields{"path": path, "error": err})
+			}
+		}
+	})
+}
+
+// applyOverrides sets overrides to config, fields tagged with
+// `required:"true"` can't be overridden with blank values
+func (configure *Configure) applyOverrides(config interface{}) error {
+	configure.mutex.Lock()
+	var paths []string
+	for path, override := range configure.overrides {
+		if !override.isExpired(time.Now()) {
+			paths = append(paths, path)
+		}
+	}
+	overrides := configure.overrides
+	configure.mutex.Unlock()
+
+	// apply parents before their fields
+	sort.Strings(paths)
+	for _, path := range paths {
+		_, fieldStruct, err := setPath(reflect.ValueOf(config).Elem(), path, overrides[path].Value, false)
+		if err != nil {
+			return fmt.Errorf("failed to override %v: %w", path, err)
+		}
+
+		if fieldStruct != nil && fieldStruct.Tag.Get("required") == "true" && reflect.ValueOf(overrides[path].Value).IsZero() {
+			return &RequiredError{Field: fieldStruct.Name}
+		}
+	}
+	return nil
+}
+
+// loadOverrides reads overrides from OverrideFile if they haven't been read
+func (configure *Configure) loadOverrides() error {
+	configure.mutex.Lock()
+	defer configure.mutex.Unlock()
+
+	if configure.OverrideFile == "" || configure.overrides != nil {
+		return nil
+	}
+
+	configure.overrides = map[string]override{}
+	data, err := ioutil.ReadFile(configure.OverrideFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var overrides map[string]override
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return fmt.Errorf("failed to read overrides from %v: %w", configure.OverrideFile, err)
+	}
+
+	for path, override := range overrides {
+		if override.isExpired(time.Now()) {
+			continue
+		}
+		configure.overrides[path] = override
+		if !override.Expires.IsZero() {
+			defer configure.scheduleExpiration(path, override.Expires)
+		}
+	}
+	return nil
+}
+
+// saveOverrides writes overrides to OverrideFile, through a temporary file
+// so that it is never partially written
+func (configure *Configure) saveOverrides() error {
+	configure.mutex.Lock()
+	defer configure.mutex.Unlock()
+
+	if configure.OverrideFile == "" {
+		return nil
+	}
+
+	overrides := map[string]override{}
+	for path, override := range configure.overrides {
+		if !override.isExpired(time.Now()) {
+			overrides[path] = override
+		}
+	}
+
+	data, err := json.MarshalIndent(overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(configure.OverrideFile, data, 0600)
+}
+
+var pathSegmentRegexp = regexp.MustCompile(`^(?:\.?([^.\[\]]+)|\[(\d+)\])`)
+
+// setPath sets value to the field at path of configValue, allocating nil
+// pointers, and growing slices to hold indexes of path if grow is true. It
+// returns the path with field names, e.g. `DB.Name` for
+// `db.name`, and the struct field of the last name of path
+func setPath(configValue reflect.Value, path string, value interface{}, grow bool) (string, *reflect.StructField, error) {
+	var (
+		field       = configValue
+		fieldStruct *reflect.StructField
+		fieldPath   string
+		rest        = path
+	)
+
+	if path == "" {
+		return "", nil, errors.New("path should not be blank")
+	}
+
+	for rest != "" {
+		matches := pathSegmentRegexp.FindStringSubmatch(rest)
+		if matches == nil {
+			return "", nil, fmt.Errorf("invalid path %v", path)
+		}
+		rest = rest[len(matches[0]):]
+
+		for field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				field.Set(reflect.New(field.Type().Elem()))
+			}
+			field = field.Elem()
+		}
+
+		switch {
+		case matches[2] != "":
+			idx, _ := strconv.Atoi(matches[2])
+			if grow && field.Kind() == reflect.Slice && idx >= field.Len() {
+				field.Set(reflect.AppendSlice(field, reflect.MakeSlice(field.Type(), idx+1-field.Len(), idx+1-field.Len())))
+			}
+			if (field.Kind() != reflect.Slice && field.Kind() != reflect.Array) || idx >= field.Len() {
+				return "", nil, fmt.Errorf("index %v of %v is out of range", idx, path)
+			}
+			field, fieldPath = field.Index(idx), fmt.Sprintf("%v[%v]", fieldPath, idx)
+		case field.Kind() == reflect.Map && field.Type().Key().Kind() == reflect.String && rest == "":
+			if field.IsNil() {
+				field.Set(reflect.MakeMap(field.Type()))
+			}
+			elem := reflect.New(field.Type().Elem()).Elem()
+			if err := setFieldValue(elem, value); err != nil {
+				return "", nil, err
+			}
+			field.SetMapIndex(reflect.ValueOf(matches[1]).Convert(field.Type().Key()), elem)
+			return joinPath(fieldPath, matches[1]), nil, nil
+		case field.Kind() == reflect.Struct:
+			next, nextStruct := findField(field, matches[1])
+			if !next.IsValid() {
+				return "", nil, fmt.Errorf("field %v of %v is not found", matches[1], path)
+			}
+			field, fieldStruct, fieldPath = next, nextStruct, joinPath(fieldPath, nextStruct.Name)
+		default:
+			return "", nil, fmt.Errorf("field %v of %v is not found", matches[1], path)
+		}
+	}
+
+	return fieldPath, fieldStruct, setFieldValue(field, value)
+}
+
+// findField returns the exported field of structValue named name, or with
+// name as key in files, case insensitively, fields of embedded structs are
+// found as well
+func findField(structValue reflect.Value, name string) (reflect.Value, *reflect.StructField) {
+	for i := 0; i < structValue.NumField(); i++ {
+		fieldStruct := structValue.Type().Field(i)
+		if fieldStruct.PkgPath != "" {
+			continue
+		}
+
+		if strings.EqualFold(fieldStruct.Name, name) {
+			return structValue.Field(i), &fieldStruct
+		}
+		for _, format := range []string{FormatYAML, FormatTOML, FormatJSON} {
+			if key, inline := documentKey(&fieldStruct, format); !inline && strings.EqualFold(key, name) {
+				return structValue.Field(i), &fieldStruct
+			}
+		}
+	}
+
+	for i := 0; i < structValue.NumField(); i++ {
+		field := reflect.Indirect(structValue.Field(i))
+		if structValue.Type().Field(i).Anonymous && field.Kind() == reflect.Struct && field.CanSet() {
+			if field, fieldStruct := findField(field, name); field.IsValid() {
+				return field, fieldStruct
+			}
+		}
+	}
+	return reflect.Value{}, nil
+}
+
+// setFieldValue converts value to the type of field and sets it, strings are
+// parsed like env variables
+func setFieldValue(field reflect.Value, value interface{}) error {
+	source := reflect.ValueOf(value)
+	switch {
+	case !source.IsValid():
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	case source.Type().AssignableTo(field.Type()):
+		field.Set(source)
+		return nil
+	case source.Kind() == reflect.String:
+		if reflect.Indirect(field).Kind() == reflect.String {
+			break
+		}
+		if field.Kind() == reflect.Bool {
+			switch strings.ToLower(source.String()) {
+			case "", "0", "f", "false":
+				field.SetBool(false)
+			default:
+				field.SetBool(true)
+			}
+			return nil
+		}
+		return yaml.Unmarshal([]byte(source.String()), field.Addr().Interface())
+	case field.Kind() != reflect.String && source.Type().ConvertibleTo(field.Type()):
+		field.Set(source.Convert(field.Type()))
+		return nil
+	}
+
+	// values read from OverrideFile, e.g. lists or maps
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, field.Addr().Interface())
+}
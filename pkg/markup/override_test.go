@@ -0,0 +1,158 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSetAndUnset(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("appname: override\ndb:\n  password: secret\ncontacts:\n- name: admin\n")
+	file.Close()
+
+	configure := New(&Config{ENVPrefix: "OVERRIDE1"})
+	if err := configure.Set("APPName", "early"); err == nil {
+		t.Errorf("Set should return error before loading configuration")
+	}
+
+	var config exampleConfig
+	if err := configure.Load(&config, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []ChangeEvent
+	configure.OnChange("", func(event ChangeEvent) {
+		events = append(events, event)
+	})
+
+	if err := configure.Set("db.port", "5432"); err != nil {
+		t.Errorf("No error should happen when set db.port, but got %v", err)
+	}
+	if err := configure.Set("Contacts[0].Email", "admin@example.com"); err != nil {
+		t.Errorf("No error should happen when set Contacts[0].Email, but got %v", err)
+	}
+	if err := configure.Set("Timeout", time.Minute); err != nil {
+		t.Errorf("No error should happen when set Timeout, but got %v", err)
+	}
+
+	if config.DB.Port != 5432 || config.Contacts[0].Email != "admin@example.com" || config.Timeout != time.Minute {
+		t.Errorf("Set should override loaded values, but got %+v", config)
+	}
+
+	if len(events) != 3 || !events[0].HasChanged("DB.Port") {
+		t.Errorf("Set should notify subscribers, but got %+v", events)
+	}
+
+	if source := configure.GetSource("DB.Port"); source != SourceOverride {
+		t.Errorf("source of overridden values should be override, but got %v", source)
+	}
+
+	for path, value := range map[string]interface{}{"DB.Unknown": "1", "Contacts[1].Name": "x", "DB.Port": "port", "DB.Password": ""} {
+		if err := configure.Set(path, value); err == nil {
+			t.Errorf("Set %v to %v should return error", path, value)
+		}
+	}
+
+	if err := configure.Unset("DB.Port"); err != nil || config.DB.Port != 3306 {
+		t.Errorf("Unset should restore loaded values, but got %v, %v", config.DB.Port, err)
+	}
+
+	if overrides := configure.Overrides(); len(overrides) != 2 {
+		t.Errorf("Unset should remove overrides, but got %v", overrides)
+	}
+}
+
+func TestSetWithTTL(t *testing.T) {
+	configure := New(&Config{ENVPrefix: "OVERRIDE2"})
+
+	var config exampleConfig
+	config.DB.Password = "secret"
+	if err := configure.Load(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	// the override expires in another goroutine, read values from events
+	events := make(chan ChangeEvent, 2)
+	configure.OnChange("APPName", func(event ChangeEvent) { events <- event })
+
+	if err := configure.SetWithTTL("appname", "temporary", 50*time.Millisecond); err != nil {
+		t.Fatalf("No error should happen when set values, but got %v", err)
+	}
+
+	if event := <-events; event.New.(*exampleConfig).APPName != "temporary" {
+		t.Errorf("SetWithTTL should override loaded values, but got %v", event.New.(*exampleConfig).APPName)
+	}
+
+	select {
+	case event := <-events:
+		if name := event.New.(*exampleConfig).APPName; name != "configure" {
+			t.Errorf("loaded values should be restored after the ttl, but got %v", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("overrides should expire after their ttl")
+	}
+
+	if overrides := configure.Overrides(); len(overrides) != 0 {
+		t.Errorf("overrides should be removed after their ttl, but got %v", overrides)
+	}
+}
+
+func TestOverrideFile(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	os.Remove(file.Name())
+	defer os.Remove(file.Name())
+
+	var config exampleConfig
+	config.DB.Password = "secret"
+	configure := New(&Config{ENVPrefix: "OVERRIDE3", OverrideFile: file.Name()})
+	if err := configure.Load(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := configure.Set("DB.Port", 5432); err != nil {
+		t.Fatal(err)
+	}
+	if err := configure.Set("Hosts", []string{"x", "y"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var restarted exampleConfig
+	restarted.DB.Password = "secret"
+	if err := New(&Config{ENVPrefix: "OVERRIDE3", OverrideFile: file.Name()}).Load(&restarted); err != nil {
+		t.Fatal(err)
+	}
+
+	if restarted.DB.Port != 5432 || len(restarted.Hosts) != 2 || restarted.Hosts[1] != "y" {
+		t.Errorf("overrides should be persisted, but got %+v", restarted)
+	}
+}
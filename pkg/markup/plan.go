@@ -0,0 +1,104 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"reflect"
+	"sync"
+)
+
+// fieldPlan holds what loading needs to know about a field of a struct,
+// parsed once for each struct type
+type fieldPlan struct {
+	index        int
+	fieldStruct  reflect.StructField
+	defaultValue string
+	required     bool
+	deprecated   string
+	aliases      []string
+	// structPtr reports whether the field is a pointer to a struct
+	structPtr bool
+}
+
+// structPlan holds the plans of the exported fields of a struct type, and
+// the `env` tags of its fields and of structs nested in it
+type structPlan struct {
+	fields  []fieldPlan
+	envTags []string
+}
+
+var planCache sync.Map // map[reflect.Type]*structPlan
+
+// cachedStructPlan returns the plan of struct type t, computing it only the
+// first time t is loaded
+func cachedStructPlan(t reflect.Type) *structPlan {
+	if plan, ok := planCache.Load(t); ok {
+		return plan.(*structPlan)
+	}
+
+	// compute the plan without lock, it might duplicate effort but won't
+	// hold other loads back, the first plan stored is kept
+	plan, _ := planCache.LoadOrStore(t, getStructPlan(t))
+	return plan.(*structPlan)
+}
+
+func getStructPlan(t reflect.Type) *structPlan {
+	plan := &structPlan{envTags: getENVTags(t, nil, map[reflect.Type]bool{})}
+	for i := 0; i < t.NumField(); i++ {
+		fieldStruct := t.Field(i)
+		if fieldStruct.PkgPath != "" {
+			continue
+		}
+
+		plan.fields = append(plan.fields, fieldPlan{
+			index:        i,
+			fieldStruct:  fieldStruct,
+			defaultValue: fieldStruct.Tag.Get("default"),
+			required:     fieldStruct.Tag.Get("required") == "true",
+			deprecated:   fieldStruct.Tag.Get("deprecated"),
+			aliases:      getAliases(&fieldStruct),
+			structPtr:    fieldStruct.Type.Kind() == reflect.Ptr && fieldStruct.Type.Elem().Kind() == reflect.Struct,
+		})
+	}
+	return plan
+}
+
+// getENVTags appends the `env` tags of fields of t, and of structs nested in
+// it, to tags
+func getENVTags(t reflect.Type, tags []string, visited map[reflect.Type]bool) []string {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct || visited[t] {
+		return tags
+	}
+	visited[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		fieldStruct := t.Field(i)
+		if envName := fieldStruct.Tag.Get("env"); envName != "" {
+			tags = append(tags, envName)
+		}
+		tags = getENVTags(fieldStruct.Type, tags, visited)
+	}
+	return tags
+}
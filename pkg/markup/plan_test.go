@@ -0,0 +1,61 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCachedStructPlan(t *testing.T) {
+	type planConfig struct {
+		Name     string `default:"configure" required:"true"`
+		Debug    bool   `aliases:"verbose, trace" deprecated:"use Log.Level"`
+		internal string
+		DB       *struct {
+			Password string `env:"DB_PASSWORD"`
+		}
+	}
+
+	plan := cachedStructPlan(reflect.TypeOf(planConfig{}))
+	if plan != cachedStructPlan(reflect.TypeOf(planConfig{})) {
+		t.Errorf("plan should be computed once for each type")
+	}
+
+	if len(plan.fields) != 3 {
+		t.Fatalf("plan should hold exported fields only, but got %+v", plan.fields)
+	}
+
+	if name := plan.fields[0]; name.defaultValue != "configure" || !name.required || name.structPtr {
+		t.Errorf("plan should parse tags of Name, but got %+v", name)
+	}
+
+	if debug := plan.fields[1]; debug.deprecated != "use Log.Level" || !reflect.DeepEqual(debug.aliases, []string{"verbose", "trace"}) {
+		t.Errorf("plan should parse tags of Debug, but got %+v", debug)
+	}
+
+	if db := plan.fields[2]; db.index != 3 || !db.structPtr {
+		t.Errorf("plan should describe DB, but got %+v", db)
+	}
+
+	if !reflect.DeepEqual(plan.envTags, []string{"DB_PASSWORD"}) {
+		t.Errorf("plan should hold env tags of nested structs, but got %v", plan.envTags)
+	}
+}
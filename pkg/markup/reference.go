@@ -0,0 +1,255 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Formats of reference documentation
+const (
+	ReferenceMarkdown = "markdown"
+	ReferenceHTML     = "html"
+	ReferenceMan      = "man"
+)
+
+// FieldReference documents a field of a config struct
+type FieldReference struct {
+	// Path of the field, e.g. `DB.Name` or `Contacts[].Email`
+	Path        string
+	Type        string
+	Default     string
+	Required    bool
+	ENV         []string
+	Description string
+}
+
+// GetReference returns the reference of every field of config. Env variables
+// of slice elements use `{N}` for their index. Descriptions are read from
+// the `usage` or `doc` tags of fields
+func (configure *Configure) GetReference(config interface{}) []FieldReference {
+	configType := reflect.TypeOf(config)
+	for configType.Kind() == reflect.Ptr {
+		configType = configType.Elem()
+	}
+
+	var prefixes []string
+	if prefix := configure.getENVPrefix(config); prefix != "-" {
+		prefixes = []string{prefix}
+	}
+	return configure.getStructReference(configType, "", prefixes, map[reflect.Type]bool{}, nil)
+}
+
+func (configure *Configure) getStructReference(t reflect.Type, path string, prefixes []string, visiting map[reflect.Type]bool, results []FieldReference) []FieldReference {
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		fieldStruct := t.Field(i)
+		if fieldStruct.PkgPath != "" && !fieldStruct.Anonymous {
+			continue
+		}
+
+		var (
+			fieldPath = joinPath(path, fieldStruct.Name)
+			fieldType = fieldStruct.Type
+		)
+
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if fieldType.Kind() == reflect.Struct && fieldType != timeType && !visiting[fieldType] {
+			if fieldStruct.Anonymous {
+				fieldPath = path
+			}
+			results = configure.getStructReference(fieldType, fieldPath, configure.getPrefixForStruct(prefixes, &fieldStruct), visiting, results)
+			continue
+		}
+
+		reference := FieldReference{
+			Path:        fieldPath,
+			Type:        getTypeName(fieldType),
+			Default:     fieldStruct.Tag.Get("default"),
+			Required:    fieldStruct.Tag.Get("required") == "true",
+			ENV:         configure.getENVNames(prefixes, &fieldStruct),
+			Description: fieldStruct.Tag.Get("usage"),
+		}
+
+		if reference.Description == "" {
+			reference.Description = fieldStruct.Tag.Get("doc")
+		}
+
+		for _, alias := range getAliases(&fieldStruct) {
+			reference.ENV = append(reference.ENV, configure.getENVNames(prefixes, &reflect.StructField{Name: alias})...)
+		}
+
+		if message := fieldStruct.Tag.Get("deprecated"); message != "" {
+			reference.Description = strings.TrimSpace(reference.Description + " Deprecated: " + message)
+		}
+
+		results = append(results, reference)
+
+		if fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Array {
+			elemType := fieldType.Elem()
+			for elemType.Kind() == reflect.Ptr {
+				elemType = elemType.Elem()
+			}
+
+			if elemType.Kind() == reflect.Struct && elemType != timeType && !visiting[elemType] {
+				results = configure.getStructReference(elemType, fieldPath+"[]", append(configure.getPrefixForStruct(prefixes, &fieldStruct), "{N}"), visiting, results)
+			}
+		}
+	}
+	return results
+}
+
+func getTypeName(t reflect.Type) string {
+	switch {
+	case t == durationType:
+		return "duration"
+	case t == timeType:
+		return "time"
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return getTypeName(t.Elem())
+	case reflect.Struct:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "[]" + getTypeName(t.Elem())
+	case reflect.Map:
+		return fmt.Sprintf("map[%v]%v", getTypeName(t.Key()), getTypeName(t.Elem()))
+	}
+	return t.Kind().String()
+}
+
+// WriteReference writes the reference documentation of config to w, in
+// format markdown, html or man
+func (configure *Configure) WriteReference(w io.Writer, config interface{}, format string) error {
+	title := reflect.Indirect(reflect.ValueOf(config)).Type().Name()
+	if title == "" {
+		title = "Configuration"
+	}
+
+	references := configure.GetReference(config)
+	switch format {
+	case ReferenceMarkdown, "md", "":
+		return writeMarkdownReference(w, title, references)
+	case ReferenceHTML:
+		return writeHTMLReference(w, title, references)
+	case ReferenceMan:
+		return writeManReference(w, title, references)
+	}
+	return fmt.Errorf("unsupported reference format %v", format)
+}
+
+// WriteReference writes the reference documentation of config to w, see Configure.WriteReference
+func WriteReference(w io.Writer, config interface{}, format string) error {
+	return New(nil).WriteReference(w, config, format)
+}
+
+func writeMarkdownReference(w io.Writer, title string, references []FieldReference) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %v\n", title)
+
+	for _, reference := range references {
+		fmt.Fprintf(&b, "\n## `%v`\n\n", reference.Path)
+		if reference.Description != "" {
+			fmt.Fprintf(&b, "%v\n\n", reference.Description)
+		}
+
+		fmt.Fprintf(&b, "- Type: `%v`\n", reference.Type)
+		if reference.Default != "" {
+			fmt.Fprintf(&b, "- Default: `%v`\n", reference.Default)
+		}
+		if reference.Required {
+			fmt.Fprintf(&b, "- Required\n")
+		}
+		if len(reference.ENV) > 0 {
+			fmt.Fprintf(&b, "- Env: `%v`\n", strings.Join(reference.ENV, "`, `"))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeHTMLReference(w io.Writer, title string, references []FieldReference) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>%v</title></head>\n<body>\n", html.EscapeString(title))
+	fmt.Fprintf(&b, "<h1>%v</h1>\n<table>\n", html.EscapeString(title))
+	fmt.Fprintf(&b, "<tr><th>Path</th><th>Type</th><th>Default</th><th>Required</th><th>Env</th><th>Description</th></tr>\n")
+
+	for _, reference := range references {
+		var required string
+		if reference.Required {
+			required = "yes"
+		}
+
+		var envs []string
+		for _, env := range reference.ENV {
+			envs = append(envs, "<code>"+html.EscapeString(env)+"</code>")
+		}
+
+		fmt.Fprintf(&b, "<tr><td><code>%v</code></td><td>%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td></tr>\n",
+			html.EscapeString(reference.Path), html.EscapeString(reference.Type), html.EscapeString(reference.Default),
+			required, strings.Join(envs, "<br>"), html.EscapeString(reference.Description))
+	}
+
+	b.WriteString("</table>\n</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeManReference(w io.Writer, title string, references []FieldReference) error {
+	escape := strings.NewReplacer(`\`, `\e`, "-", `\-`, "\n", " ").Replace
+
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH %v 5\n", strings.ToUpper(escape(title)))
+	fmt.Fprintf(&b, ".SH NAME\n%v \\- configuration reference\n.SH FIELDS\n", escape(title))
+
+	for _, reference := range references {
+		fmt.Fprintf(&b, ".TP\n.B %v\n", escape(reference.Path))
+		if reference.Description != "" {
+			fmt.Fprintf(&b, "%v\n.br\n", escape(reference.Description))
+		}
+
+		fmt.Fprintf(&b, "Type: %v\n", escape(reference.Type))
+		if reference.Default != "" {
+			fmt.Fprintf(&b, ".br\nDefault: %v\n", escape(reference.Default))
+		}
+		if reference.Required {
+			fmt.Fprintf(&b, ".br\nRequired\n")
+		}
+		if len(reference.ENV) > 0 {
+			fmt.Fprintf(&b, ".br\nEnv: %v\n", escape(strings.Join(reference.ENV, ", ")))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
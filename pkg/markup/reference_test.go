@@ -0,0 +1,90 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetReference(t *testing.T) {
+	type referenceConfig struct {
+		Level string `default:"info" usage:"minimum level of logs"`
+		DB    struct {
+			Password string `required:"true"`
+			PoolSize int    `aliases:"pool"`
+		}
+		Menus []Menu
+	}
+
+	references := New(&Config{ENVPrefix: "DOC1"}).GetReference(&referenceConfig{})
+
+	var paths []string
+	for _, reference := range references {
+		paths = append(paths, reference.Path)
+	}
+
+	if want := []string{"Level", "DB.Password", "DB.PoolSize", "Menus", "Menus[].Key", "Menus[].Name", "Menus[].Icon", "Menus[].Children"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("reference should list every field, but got %v", paths)
+	}
+
+	if level := references[0]; level.Default != "info" || level.Description != "minimum level of logs" || level.Type != "string" {
+		t.Errorf("reference should read default and usage tags, but got %+v", level)
+	}
+
+	if pool := references[2]; !reflect.DeepEqual(pool.ENV, []string{"DOC1_DB_PoolSize", "DOC1_DB_POOLSIZE", "DOC1_DB_pool", "DOC1_DB_POOL"}) {
+		t.Errorf("reference should list every accepted env variable, but got %v", pool.ENV)
+	}
+
+	if key := references[4]; !reflect.DeepEqual(key.ENV, []string{"DOC1_Menus_{N}_Key", "DOC1_MENUS_{N}_KEY"}) {
+		t.Errorf("reference should list env variables of slice elements, but got %v", key.ENV)
+	}
+
+	for _, format := range []string{ReferenceMarkdown, ReferenceHTML, ReferenceMan} {
+		var buffer bytes.Buffer
+		if err := New(&Config{ENVPrefix: "DOC1"}).WriteReference(&buffer, &referenceConfig{}, format); err != nil {
+			t.Errorf("No error should happen when write %v reference, but got %v", format, err)
+		}
+
+		if !strings.Contains(buffer.String(), "DOC1_DB_PASSWORD") {
+			t.Errorf("%v reference should list env variables, but got %v", format, buffer.String())
+		}
+	}
+}
+
+func TestWriteReferenceWithoutENV(t *testing.T) {
+	type referenceConfig struct {
+		Token string `env:"-"`
+	}
+
+	for _, format := range []string{ReferenceMarkdown, ReferenceMan} {
+		var buffer bytes.Buffer
+		if err := New(&Config{ENVPrefix: "DOC2"}).WriteReference(&buffer, &referenceConfig{}, format); err != nil {
+			t.Errorf("No error should happen when write %v reference, but got %v", format, err)
+		}
+
+		if !strings.Contains(buffer.String(), "Token") || strings.Contains(buffer.String(), "Env:") {
+			t.Errorf("%v reference should skip env of fields without env variables, but got %v", format, buffer.String())
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// ChangeEvent describes the changes applied to a configuration by a reload
+type ChangeEvent struct {
+	// Old is a snapshot of the configuration before the reload
+	Old interface{}
+	// New is a snapshot of the configuration after the reload
+	New interface{}
+	// Changed holds the paths of the changed fields, e.g. `DB.Name` or `Contacts[0].Email`
+	Changed []string
+	// RestartRequired holds the paths of fields tagged with `reload:"restart"`
+	// that have been changed, but kept at their running values
+	RestartRequired []string
+}
+
+// HasChanged reports whether the field at path, a field nested in it or one
+// of its parents has been changed
+func (event ChangeEvent) HasChanged(path string) bool {
+	for _, changed := range event.Changed {
+		if matchPath(path, changed) {
+			return true
+		}
+	}
+	return false
+}
+
+type subscriber struct {
+	path string
+	fn   func(event ChangeEvent)
+}
+
+// OnChange registers fn to be called after a reload changed the field at path,
+// e.g. `DB` or `DB.Name`. An empty path subscribes to every change
+func (configure *Configure) OnChange(path string, fn func(event ChangeEvent)) {
+	configure.mutex.Lock()
+	defer configure.mutex.Unlock()
+	configure.subscribers = append(configure.subscribers, subscriber{path: path, fn: fn})
+}
+
+func (configure *Configure) notify(event ChangeEvent) {
+	configure.mutex.Lock()
+	subscribers := append([]subscriber{}, configure.subscribers...)
+	configure.mutex.Unlock()
+
+	for _, subscriber := range subscribers {
+		if subscriber.path == "" || event.HasChanged(subscriber.path) {
+			subscriber.fn(event)
+		}
+	}
+}
+
+// reload loads configurations from files into a copy of initialValue, the
+// value of config before Load, and swaps it in. In watch mode, files are
+// loaded only if they have been changed. override tells that it applies a new
+// override, whose failure is recorded apart from failed loads
+func (configure *Configure) reload(config interface{}, initialValue reflect.Value, watchMode, override bool, files ...string) (bool, error) {
+	configure.reloadMutex.Lock()
+	defer configure.reloadMutex.Unlock()
+
+	newValue := cloneValue(initialValue)
+	err, changed := configure.load(newValue.Addr().Interface(), watchMode, files...)
+	if err != nil || !changed {
+		if changed {
+			configure.recordLoad(true, override, config, err)
+		}
+		return changed, err
+	}
+
+	configure.swap(reflect.ValueOf(config).Elem(), newValue)
+	configure.recordLoad(true, override, config, nil)
+	return true, nil
+}
+
+// forceReload reloads the configuration last loaded by Load, whether its
+// files have been changed or not
+func (configure *Configure) forceReload(override bool) error {
+	configure.mutex.Lock()
+	config, initialValue, files := configure.config, configure.initialValue, configure.files
+	configure.mutex.Unlock()
+
+	if config == nil {
+		return errors.New("no configuration has been loaded")
+	}
+
+	_, err := configure.reload(config, initialValue, false, override, files...)
+	return err
+}
+
+// Reload loads the configuration from its files again, whether they have
+// been changed or not, and returns once it has been applied, or the error
+// that prevented it, e.g. a required field being blank, in which case the
+// running configuration is kept
+func (configure *Configure) Reload() error {
+	return configure.forceReload(false)
+}
+
+// ReloadOnSignal reloads the configuration like Reload whenever the process
+// receives one of signals, syscall.SIGHUP if none is given. Results are
+// logged and passed to fn if it is not nil. Call stop to uninstall it
+func (configure *Configure) ReloadOnSignal(fn func(err error), signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, signals...)
+
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				err := configure.Reload()
+				if err != nil {
+					configure.log(LevelError, "Failed to reload configuration", Fields{"signal": sig, "error": err})
+				} else {
+					configure.log(LevelInfo, "Configuration reloaded", Fields{"signal": sig})
+				}
+
+				if fn != nil {
+					fn(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// swap applies reload policies to newValue, sets it to configValue and
+// notifies subscribers of the changes
+func (configure *Configure) swap(configValue, newValue reflect.Value) {
+	oldValue := cloneValue(configValue)
+
+	restart := applyReloadPolicies("", oldValue, newValue, nil)
+	configure.mutex.Lock()
+	configure.pendingChanges = restart
+	configure.mutex.Unlock()
+
+	if len(restart) > 0 {
+		configure.log(LevelWarn, "Configuration changed, restart required to apply it", Fields{"paths": strings.Join(restart, ", ")})
+	}
+
+	configValue.Set(newValue)
+	configure.mutex.Lock()
+	configure.loadedValue = cloneValue(newValue)
+	configure.mutex.Unlock()
+
+	if configure.Config.AutoReloadCallback != nil {
+		configure.Config.AutoReloadCallback(configValue.Addr().Interface())
+	}
+
+	if paths := diffValues("", oldValue, newValue, nil); len(paths) > 0 || len(restart) > 0 {
+		configure.notify(ChangeEvent{Old: oldValue.Addr().Interface(), New: newValue.Addr().Interface(), Changed: paths, RestartRequired: restart})
+	}
+}
+
+// PendingChanges returns the paths of fields tagged with `reload:"restart"`
+// whose changes have been loaded, but not applied yet
+func (configure *Configure) PendingChanges() []string {
+	configure.mutex.Lock()
+	defer configure.mutex.Unlock()
+	return append([]string{}, configure.pendingChanges...)
+}
+
+// applyReloadPolicies keeps the running values of changed fields tagged with
+// `reload:"restart"` or `reload:"ignore"`, and returns the paths of the
+// restart ones
+func applyReloadPolicies(path string, oldValue, newValue reflect.Value, restart []string) []string {
+	for oldValue.Kind() == reflect.Ptr {
+		if oldValue.IsNil() || newValue.IsNil() {
+			return restart
+		}
+		oldValue, newValue = oldValue.Elem(), newValue.Elem()
+	}
+
+	if oldValue.Kind() != reflect.Struct {
+		return restart
+	}
+
+	for i := 0; i < oldValue.NumField(); i++ {
+		fieldStruct := oldValue.Type().Field(i)
+		if fieldStruct.PkgPath != "" {
+			continue
+		}
+
+		fieldPath := joinPath(path, fieldStruct.Name)
+		switch policy := fieldStruct.Tag.Get("reload"); policy {
+		case "restart", "ignore":
+			if len(diffValues(fieldPath, oldValue.Field(i), newValue.Field(i), nil)) > 0 {
+				newValue.Field(i).Set(oldValue.Field(i))
+				if policy == "restart" {
+					restart = append(restart, fieldPath)
+				}
+			}
+		default:
+			restart = applyReloadPolicies(fieldPath, oldValue.Field(i), newValue.Field(i), restart)
+		}
+	}
+	return restart
+}
+
+// matchPath reports whether path and changed refer to the same field, or one
+// is nested in the other
+func matchPath(path, changed string) bool {
+	if path == "" || path == changed {
+		return true
+	}
+
+	for _, sep := range []string{".", "["} {
+		if strings.HasPrefix(changed, path+sep) || strings.HasPrefix(path, changed+sep) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// diffValues appends the paths of fields that differ between oldValue and
+// newValue to changed
+func diffValues(path string, oldValue, newValue reflect.Value, changed []string) []string {
+	switch oldValue.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if oldValue.IsNil() || newValue.IsNil() {
+			if oldValue.IsNil() != newValue.IsNil() {
+				changed = append(changed, path)
+			}
+			return changed
+		}
+		if oldValue.Kind() == reflect.Interface && oldValue.Elem().Type() != newValue.Elem().Type() {
+			return append(changed, path)
+		}
+		return diffValues(path, oldValue.Elem(), newValue.Elem(), changed)
+	case reflect.Struct:
+		if !hasExportedFields(oldValue.Type()) {
+			break
+		}
+		for i := 0; i < oldValue.NumField(); i++ {
+			if fieldStruct := oldValue.Type().Field(i); fieldStruct.PkgPath == "" {
+				changed = diffValues(joinPath(path, fieldStruct.Name), oldValue.Field(i), newValue.Field(i), changed)
+			}
+		}
+		return changed
+	case reflect.Slice, reflect.Array:
+		if oldValue.Len() != newValue.Len() {
+			return append(changed, path)
+		}
+		for i := 0; i < oldValue.Len(); i++ {
+			changed = diffValues(fmt.Sprintf("%v[%v]", path, i), oldValue.Index(i), newValue.Index(i), changed)
+		}
+		return changed
+	}
+
+	if !reflect.DeepEqual(oldValue.Interface(), newValue.Interface()) {
+		changed = append(changed, path)
+	}
+	return changed
+}
+
+func hasExportedFields(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneValue returns an addressable deep copy of value
+func cloneValue(value reflect.Value) reflect.Value {
+	clone := reflect.New(value.Type()).Elem()
+	copyValue(clone, value)
+	return clone
+}
+
+func copyValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if !src.IsNil() {
+			ptr := reflect.New(src.Type().Elem())
+			copyValue(ptr.Elem(), src.Elem())
+			dst.Set(ptr)
+		}
+	case reflect.Interface:
+		if !src.IsNil() {
+			value := reflect.New(src.Elem().Type()).Elem()
+			copyValue(value, src.Elem())
+			dst.Set(value)
+		}
+	case reflect.Struct:
+		// copy unexported fields as they are, then deep copy exported ones
+		dst.Set(src)
+		for i := 0; i < src.NumField(); i++ {
+			if dst.Field(i).CanSet() {
+				copyValue(dst.Field(i), src.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if !src.IsNil() {
+			slice := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+			for i := 0; i < src.Len(); i++ {
+				copyValue(slice.Index(i), src.Index(i))
+			}
+			dst.Set(slice)
+		}
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			copyValue(dst.Index(i), src.Index(i))
+		}
+	case reflect.Map:
+		if !src.IsNil() {
+			m := reflect.MakeMapWithSize(src.Type(), src.Len())
+			for iter := src.MapRange(); iter.Next(); {
+				value := reflect.New(src.Type().Elem()).Elem()
+				copyValue(value, iter.Value())
+				m.SetMapIndex(iter.Key(), value)
+			}
+			dst.Set(m)
+		}
+	default:
+		dst.Set(src)
+	}
+}
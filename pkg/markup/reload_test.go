@@ -0,0 +1,268 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestReloadNotifyChangedPaths(t *testing.T) {
+	config := generateDefaultConfig()
+
+	file, err := ioutil.TempFile("/tmp", "bhojpur*.yml")
+	if err != nil {
+		t.Fatal("Could not create temp file")
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	data, _ := yaml.Marshal(config)
+	file.Write(data)
+
+	var (
+		result     testConfig
+		dbEvents   []ChangeEvent
+		nameEvents []ChangeEvent
+		allEvents  []ChangeEvent
+		configure  = New(&Config{ENVPrefix: "RELOAD1"})
+	)
+
+	configure.OnChange("DB", func(event ChangeEvent) { dbEvents = append(dbEvents, event) })
+	configure.OnChange("APPName", func(event ChangeEvent) { nameEvents = append(nameEvents, event) })
+	configure.OnChange("", func(event ChangeEvent) { allEvents = append(allEvents, event) })
+
+	if err := configure.Load(&result, file.Name()); err != nil {
+		t.Fatalf("No error should happen when load configurations, but got %v", err)
+	}
+
+	config.DB.Name = "reloaded"
+	config.Contacts = append(config.Contacts, config.Contacts[0])
+	data, _ = yaml.Marshal(config)
+	ioutil.WriteFile(file.Name(), data, 0644)
+	modTime := time.Now().Add(time.Minute)
+	os.Chtimes(file.Name(), modTime, modTime)
+
+	if changed, err := configure.reload(&result, configure.initialValue, true, false, file.Name()); err != nil || !changed {
+		t.Fatalf("configuration should be reloaded, but got changed %v, error %v", changed, err)
+	}
+
+	if !reflect.DeepEqual(result, config) {
+		t.Errorf("result should be reloaded, but got %+v", result)
+	}
+
+	if len(nameEvents) != 0 {
+		t.Errorf("APPName subscriber should not be notified, but got %+v", nameEvents)
+	}
+
+	if len(dbEvents) != 1 || len(allEvents) != 1 {
+		t.Fatalf("DB subscriber should be notified once, but got %v events", len(dbEvents))
+	}
+
+	event := dbEvents[0]
+	if !reflect.DeepEqual(event.Changed, []string{"DB.Name", "Contacts"}) {
+		t.Errorf("changed paths should be DB.Name and Contacts, but got %v", event.Changed)
+	}
+
+	if old := event.Old.(*testConfig); old.DB.Name != "bhojpur" || len(old.Contacts) != 1 {
+		t.Errorf("old snapshot should hold the previous configuration, but got %+v", old)
+	}
+
+	if !event.HasChanged("Contacts[1].Email") || event.HasChanged("DB.User") {
+		t.Errorf("HasChanged should match nested and parent paths only")
+	}
+}
+
+func TestReloadPolicies(t *testing.T) {
+	type serverConfig struct {
+		Listen  string `reload:"restart"`
+		DataDir string `reload:"ignore"`
+		Level   string
+	}
+
+	file, err := ioutil.TempFile("/tmp", "bhojpur*.yml")
+	if err != nil {
+		t.Fatal("Could not create temp file")
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("listen: :8080\ndatadir: /var/lib/a\nlevel: info\n")
+
+	var (
+		result    serverConfig
+		events    []ChangeEvent
+		configure = New(&Config{ENVPrefix: "RELOAD2", Silent: true})
+	)
+	configure.OnChange("", func(event ChangeEvent) { events = append(events, event) })
+
+	if err := configure.Load(&result, file.Name()); err != nil {
+		t.Fatalf("No error should happen when load configurations, but got %v", err)
+	}
+
+	ioutil.WriteFile(file.Name(), []byte("listen: :9090\ndatadir: /var/lib/b\nlevel: debug\n"), 0644)
+	modTime := time.Now().Add(time.Minute)
+	os.Chtimes(file.Name(), modTime, modTime)
+
+	if _, err := configure.reload(&result, configure.initialValue, true, false, file.Name()); err != nil {
+		t.Fatalf("No error should happen when reload configurations, but got %v", err)
+	}
+
+	if (result != serverConfig{Listen: ":8080", DataDir: "/var/lib/a", Level: "debug"}) {
+		t.Errorf("restart and ignore fields should keep running values, but got %+v", result)
+	}
+
+	if pending := configure.PendingChanges(); !reflect.DeepEqual(pending, []string{"Listen"}) {
+		t.Errorf("Listen should be pending a restart, but got %v", pending)
+	}
+
+	if len(events) != 1 || !reflect.DeepEqual(events[0].Changed, []string{"Level"}) || !reflect.DeepEqual(events[0].RestartRequired, []string{"Listen"}) {
+		t.Errorf("event should report Level changed and Listen requiring restart, but got %+v", events)
+	}
+
+	ioutil.WriteFile(file.Name(), []byte("listen: :8080\ndatadir: /var/lib/b\nlevel: debug\n"), 0644)
+	modTime = modTime.Add(time.Minute)
+	os.Chtimes(file.Name(), modTime, modTime)
+	configure.reload(&result, configure.initialValue, true, false, file.Name())
+
+	if pending := configure.PendingChanges(); len(pending) != 0 {
+		t.Errorf("pending changes should be cleared when Listen is reverted, but got %v", pending)
+	}
+}
+
+func TestReload(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "bhojpur*.yml")
+	if err != nil {
+		t.Fatal("Could not create temp file")
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("db:\n  name: before\n  password: secret\n")
+	file.Close()
+
+	configure := New(&Config{ENVPrefix: "RELOAD3"})
+	var config exampleConfig
+	if err := configure.Load(&config, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	// keep the modification time, Reload should not depend on it
+	info, _ := os.Stat(file.Name())
+	ioutil.WriteFile(file.Name(), []byte("db:\n  name: after\n  password: secret\n"), 0644)
+	os.Chtimes(file.Name(), info.ModTime(), info.ModTime())
+
+	if err := configure.Reload(); err != nil || config.DB.Name != "after" {
+		t.Errorf("Reload should load changes, but got %v, %v", config.DB.Name, err)
+	}
+
+	ioutil.WriteFile(file.Name(), []byte("db:\n  name: invalid\n"), 0644)
+	if err := configure.Reload(); err == nil || config.DB.Name != "after" {
+		t.Errorf("Reload should return validation errors and keep the running configuration, but got %v, %v", config.DB.Name, err)
+	}
+}
+
+func TestReloadOnSignal(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "bhojpur*.yml")
+	if err != nil {
+		t.Fatal("Could not create temp file")
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("db:\n  name: before\n  password: secret\n")
+	file.Close()
+
+	configure := New(&Config{ENVPrefix: "RELOAD4", Silent: true})
+	var config exampleConfig
+	if err := configure.Load(&config, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan error, 1)
+	stop := configure.ReloadOnSignal(func(err error) { results <- err })
+	defer stop()
+
+	ioutil.WriteFile(file.Name(), []byte("db:\n  name: after\n  password: secret\n"), 0644)
+	process, _ := os.FindProcess(os.Getpid())
+	process.Signal(syscall.SIGHUP)
+
+	select {
+	case err := <-results:
+		if err != nil || config.DB.Name != "after" {
+			t.Errorf("signals should reload configuration, but got %v, %v", config.DB.Name, err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("signals should reload configuration")
+	}
+}
+
+func TestReloadClearsRemovedKeys(t *testing.T) {
+	type labelsConfig struct {
+		Name   string
+		Labels map[string]string
+	}
+
+	file, err := ioutil.TempFile("/tmp", "bhojpur*.yml")
+	if err != nil {
+		t.Fatal("Could not create temp file")
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("name: before\nlabels:\n  team: a\n  tier: web\n")
+	file.Close()
+
+	var (
+		result    labelsConfig
+		events    []ChangeEvent
+		configure = New(&Config{ENVPrefix: "RELOAD5", Silent: true})
+	)
+	configure.OnChange("", func(event ChangeEvent) { events = append(events, event) })
+
+	if err := configure.Load(&result, file.Name()); err != nil {
+		t.Fatalf("No error should happen when load configurations, but got %v", err)
+	}
+
+	ioutil.WriteFile(file.Name(), []byte("labels:\n  team: a\n"), 0644)
+	modTime := time.Now().Add(time.Minute)
+	os.Chtimes(file.Name(), modTime, modTime)
+
+	if _, err := configure.reload(&result, configure.initialValue, true, false, file.Name()); err != nil {
+		t.Fatalf("No error should happen when reload configurations, but got %v", err)
+	}
+
+	if !reflect.DeepEqual(result, labelsConfig{Labels: map[string]string{"team": "a"}}) {
+		t.Errorf("keys removed from files should be cleared when files are watched, but got %+v", result)
+	}
+
+	if err := configure.Reload(); err != nil {
+		t.Fatalf("No error should happen when reload configurations, but got %v", err)
+	}
+
+	if len(events) != 1 || !reflect.DeepEqual(events[0].Changed, []string{"Name", "Labels"}) {
+		t.Errorf("watched reloads and Reload should agree on changes, but got %+v", events)
+	}
+
+	if source := configure.GetSource("Name"); source != "" {
+		t.Errorf("Name should have no source once removed, but got %v", source)
+	}
+}
@@ -0,0 +1,1049 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bhojpur/configure/pkg/toml"
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// documentChange is a value to write at keys of a document
+type documentChange struct {
+	keys  []string
+	value interface{}
+	// secret is true for fields tagged with `secret:"true"`
+	secret bool
+}
+
+// Save writes the fields of config that have been changed since it was
+// loaded to file, usually one of its configuration files. Other keys,
+// comments and layout of YAML and TOML files are kept, JSON files are
+// rewritten. Files are written through Config.FileSystem, which must be a
+// WritableFileSystem. Fields set by env variables, set values or overrides
+// can't be saved, an error is returned if they have been changed. Fields
+// tagged with `secret:"true"` and values that were encrypted are written
+// encrypted with the first key of KeyProvider, they can't be saved without
+// keys
+func (configure *Configure) Save(config interface{}, file string) error {
+	configValue := reflect.Indirect(reflect.ValueOf(config))
+
+	configure.mutex.Lock()
+	loadedValue := configure.loadedValue
+	configure.mutex.Unlock()
+
+	if !loadedValue.IsValid() || loadedValue.Type() != configValue.Type() {
+		return fmt.Errorf("no configuration of type %v has been loaded", configValue.Type())
+	}
+
+	var paths []string
+	for _, path := range diffValues("", loadedValue, configValue, nil) {
+		if source := configure.GetSource(path); source == SourceENV || source == SourceOverride || strings.HasPrefix(source, SourceSet) {
+			return fmt.Errorf("%v is set by %v, it can't be saved", path, source)
+		}
+
+		// lists are saved as a whole
+		if idx := strings.Index(path, "["); idx >= 0 {
+			path = path[:idx]
+		}
+		if len(paths) == 0 || paths[len(paths)-1] != path {
+			paths = append(paths, path)
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil
+	}
+
+	info, err := configure.stat(file)
+	if err != nil {
+		return err
+	}
+	data, err := configure.readFile(file)
+	if err != nil {
+		return err
+	}
+
+	format := getFileFormat(file)
+	if format == "" {
+		format = detectFormat(data)
+	}
+
+	doc, err := decodeDocument(data, format)
+	if err != nil {
+		return newDecodeError(file, data, format, err)
+	}
+
+	changes, err := getDocumentChanges(configValue, paths, format)
+	if err != nil {
+		return err
+	}
+	var provider KeyProvider
+	for idx, change := range changes {
+		change = matchDocumentKeys(doc, change, format)
+
+		// keep secrets encrypted, rather than writing them in plain text
+		original, _ := lookupDocument(doc, change.keys)
+		if envelope, _ := original.(string); change.secret || IsEncryptedValue(envelope) {
+			if provider == nil {
+				if provider, err = configure.getKeyProvider(); err != nil {
+					return fmt.Errorf("%v is secret, it can't be saved without keys to encrypt it: %w", strings.Join(change.keys, "."), err)
+				}
+			}
+			if change.value, err = encryptDocumentValue(provider, change.value); err != nil {
+				return fmt.Errorf("%v is secret, it can't be saved: %w", strings.Join(change.keys, "."), err)
+			}
+		}
+		changes[idx] = change
+	}
+
+	var result []byte
+	switch format {
+	case FormatYAML:
+		result, err = editYAML(data, changes)
+	case FormatTOML:
+		result, err = editTOML(data, changes)
+	case FormatJSON:
+		result, err = editJSON(data, changes)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save %v: %w", file, err)
+	}
+
+	if err := verifyDocument(result, format, changes); err != nil {
+		return fmt.Errorf("failed to save %v: %w", file, err)
+	}
+
+	if err := configure.writeFile(file, result, info.Mode()); err != nil {
+		return err
+	}
+
+	configure.mutex.Lock()
+	configure.loadedValue = cloneValue(configValue)
+	configure.mutex.Unlock()
+	return nil
+}
+
+// getDocumentChanges returns the values of fields at paths of configValue,
+// with their keys in documents of format
+func getDocumentChanges(configValue reflect.Value, paths []string, format string) ([]documentChange, error) {
+	var (
+		buffer bytes.Buffer
+		err    error
+	)
+	switch format {
+	case FormatYAML:
+		var data []byte
+		data, err = yaml.Marshal(configValue.Interface())
+		buffer.Write(data)
+	case FormatTOML:
+		err = toml.NewEncoder(&buffer).Encode(configValue.Interface())
+	case FormatJSON:
+		err = json.NewEncoder(&buffer).Encode(configValue.Interface())
+	default:
+		err = fmt.Errorf("unsupported format %v", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := decodeDocument(buffer.Bytes(), format)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []documentChange
+	for _, path := range paths {
+		keys, fieldStruct, ok := getDocumentKeys(configValue.Type(), path, format)
+		if !ok {
+			continue
+		}
+
+		secret := fieldStruct.Tag.Get("secret") == "true"
+		if !secret && hasSecretFields(fieldStruct.Type) {
+			return nil, fmt.Errorf("%v holds secret fields, it can't be saved", path)
+		}
+
+		if value, ok := lookupDocument(doc, keys); ok {
+			changes = append(changes, documentChange{keys: keys, value: value, secret: secret})
+		}
+	}
+	return changes, nil
+}
+
+// getDocumentKeys returns the keys of the field at path of struct type t in
+// documents of format with the field, or false if the field isn't decoded
+// from files
+func getDocumentKeys(t reflect.Type, path, format string) ([]string, *reflect.StructField, bool) {
+	var (
+		keys        []string
+		fieldStruct reflect.StructField
+	)
+	for _, name := range strings.Split(path, ".") {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, nil, false
+		}
+
+		var ok bool
+		if fieldStruct, ok = t.FieldByName(name); !ok {
+			return nil, nil, false
+		}
+
+		key, inline := documentKey(&fieldStruct, format)
+		if key == "-" {
+			return nil, nil, false
+		}
+		if !inline {
+			keys = append(keys, key)
+		}
+		t = fieldStruct.Type
+	}
+	return keys, &fieldStruct, len(keys) > 0
+}
+
+// encryptDocumentValue returns the envelope of value encrypted with the first
+// key of provider, values are encrypted as they are written in files
+func encryptDocumentValue(provider KeyProvider, value interface{}) (interface{}, error) {
+	switch value.(type) {
+	case nil:
+		value = ""
+	case map[string]interface{}, []interface{}, []map[string]interface{}:
+		return nil, errors.New("only scalar values can be encrypted")
+	}
+	return EncryptValue(provider, fmt.Sprint(value))
+}
+
+// matchDocumentKeys returns change with keys written like those of doc, as
+// TOML and JSON decoders match keys case insensitively. Missing keys are
+// lower cased if the keys of their table are
+func matchDocumentKeys(doc map[string]interface{}, change documentChange, format string) documentChange {
+	if format == FormatYAML {
+		return change
+	}
+
+	var (
+		keys    []string
+		current = doc
+		lower   bool
+	)
+	for _, key := range change.keys {
+		if len(current) > 0 {
+			lower = isLowerDocument(current)
+		}
+
+		if existing, ok := findDocumentKey(current, key, format); ok {
+			keys = append(keys, existing)
+			current, _ = current[existing].(map[string]interface{})
+			continue
+		}
+
+		if lower {
+			key = strings.ToLower(key)
+		}
+		keys, current = append(keys, key), nil
+	}
+
+	change.keys = keys
+	if lower {
+		change.value = lowerDocumentKeys(change.value)
+	}
+	return change
+}
+
+func isLowerDocument(doc map[string]interface{}) bool {
+	for key := range doc {
+		if key != strings.ToLower(key) {
+			return false
+		}
+	}
+	return true
+}
+
+func lowerDocumentKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[strings.ToLower(key)] = lowerDocumentKeys(value)
+		}
+		return m
+	case []map[string]interface{}:
+		list := make([]map[string]interface{}, len(v))
+		for i, value := range v {
+			list[i] = lowerDocumentKeys(value).(map[string]interface{})
+		}
+		return list
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, value := range v {
+			list[i] = lowerDocumentKeys(value)
+		}
+		return list
+	}
+	return value
+}
+
+func lookupDocument(doc map[string]interface{}, keys []string) (interface{}, bool) {
+	var value interface{} = doc
+	for _, key := range keys {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// nestDocument returns value nested in maps of keys
+func nestDocument(keys []string, value interface{}) interface{} {
+	for i := len(keys) - 1; i >= 0; i-- {
+		value = map[string]interface{}{keys[i]: value}
+	}
+	return value
+}
+
+// verifyDocument checks data can be decoded, and holds the values of changes
+func verifyDocument(data []byte, format string, changes []documentChange) error {
+	doc, err := decodeDocument(data, format)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		if value, _ := lookupDocument(doc, change.keys); !reflect.DeepEqual(value, change.value) {
+			return fmt.Errorf("%v should be %v after editing, but got %v", strings.Join(change.keys, "."), change.value, value)
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file, and renames it to name
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	file, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err = file.Write(data); err == nil {
+		err = file.Chmod(perm)
+	}
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), name)
+}
+
+func editJSON(data []byte, changes []documentChange) ([]byte, error) {
+	doc, err := decodeDocument(data, FormatJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		mergeDocument(doc, nestDocument(change.keys, change.value).(map[string]interface{}))
+	}
+
+	result, err := json.MarshalIndent(doc, "", "  ")
+	return append(result, '\n'), err
+}
+
+// editYAML writes changes to YAML data, changing lines of their keys only
+func editYAML(data []byte, changes []documentChange) ([]byte, error) {
+	if len(splitYAMLDocuments(data)) > 1 {
+		return nil, errors.New("multi-document YAML files can't be saved")
+	}
+
+	lines := strings.Split(string(data), "\n")
+	for _, change := range changes {
+		// parse data again, as positions are changed by previous changes
+		var root yamlv3.Node
+		if err := yamlv3.Unmarshal([]byte(strings.Join(lines, "\n")), &root); err != nil {
+			return nil, err
+		}
+
+		mapping := &yamlv3.Node{Kind: yamlv3.MappingNode}
+		if root.Kind == yamlv3.DocumentNode && len(root.Content) > 0 {
+			mapping = root.Content[0]
+		}
+		if mapping.Kind != yamlv3.MappingNode {
+			return nil, errors.New("yaml document should be a mapping")
+		}
+
+		var err error
+		if lines, err = editYAMLMapping(lines, mapping, change.keys, change.value); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+func editYAMLMapping(lines []string, mapping *yamlv3.Node, keys []string, value interface{}) ([]string, error) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		keyNode, valueNode := mapping.Content[i], mapping.Content[i+1]
+		if keyNode.Value != keys[0] {
+			continue
+		}
+
+		if len(keys) == 1 {
+			return replaceYAMLEntry(lines, keyNode, valueNode, value)
+		}
+
+		if valueNode.Kind == yamlv3.MappingNode && valueNode.Style&yamlv3.FlowStyle == 0 && len(valueNode.Content) > 0 {
+			return editYAMLMapping(lines, valueNode, keys[1:], value)
+		}
+
+		// merge into values that can't be edited in place, like flow mappings
+		var existing interface{}
+		if err := valueNode.Decode(&existing); err != nil {
+			return nil, err
+		}
+		merged, ok := existing.(map[string]interface{})
+		if !ok {
+			merged = map[string]interface{}{}
+		}
+		mergeDocument(merged, nestDocument(keys[1:], value).(map[string]interface{}))
+		return replaceYAMLBlock(lines, keyNode, merged)
+	}
+
+	// insert missing keys after the last entry of mapping
+	entry, err := renderYAMLEntry(keys[0], nestDocument(keys[1:], value))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(mapping.Content) == 0 {
+		// an empty document
+		for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+			lines = lines[:len(lines)-1]
+		}
+		return append(append(lines, entry...), ""), nil
+	}
+
+	lastKey := mapping.Content[len(mapping.Content)-2]
+	indent := mapping.Content[0].Column - 1
+	end := getYAMLEntryEnd(lines, lastKey.Line-1, lastKey.Column-1)
+
+	var inserted []string
+	for _, line := range entry {
+		inserted = append(inserted, strings.Repeat(" ", indent)+line)
+	}
+	return append(lines[:end], append(inserted, lines[end:]...)...), nil
+}
+
+// replaceYAMLEntry replaces the value of keyNode with value, in place if both
+// are single line scalars
+func replaceYAMLEntry(lines []string, keyNode, valueNode *yamlv3.Node, value interface{}) ([]string, error) {
+	_, isMap := value.(map[string]interface{})
+	_, isList := value.([]interface{})
+
+	// keep flow collections written on the line of their key in flow style
+	if (isMap || isList) && valueNode.Style&yamlv3.FlowStyle != 0 && valueNode.Line == keyNode.Line && valueNode.Anchor == "" {
+		var node yamlv3.Node
+		if err := node.Encode(value); err != nil {
+			return nil, err
+		}
+		setYAMLFlowStyle(&node)
+
+		flow, err := yamlv3.Marshal(&node)
+		if err != nil {
+			return nil, err
+		}
+
+		line := []rune(lines[keyNode.Line-1])
+		start := valueNode.Column - 1
+		if end := getYAMLFlowEnd(line, start); end > 0 && !strings.Contains(strings.TrimSuffix(string(flow), "\n"), "\n") {
+			lines[keyNode.Line-1] = string(line[:start]) + strings.TrimSuffix(string(flow), "\n") + string(line[end:])
+			return lines, nil
+		}
+	}
+
+	if !isMap && !isList && valueNode.Kind == yamlv3.ScalarNode && valueNode.Line == keyNode.Line &&
+		valueNode.Anchor == "" && valueNode.Style&(yamlv3.LiteralStyle|yamlv3.FoldedStyle|yamlv3.TaggedStyle) == 0 {
+		var node yamlv3.Node
+		if err := node.Encode(value); err != nil {
+			return nil, err
+		}
+		if _, ok := value.(string); ok && valueNode.Style&(yamlv3.SingleQuotedStyle|yamlv3.DoubleQuotedStyle) != 0 {
+			node.Style = valueNode.Style
+		}
+
+		scalar, err := yamlv3.Marshal(&node)
+		if err != nil {
+			return nil, err
+		}
+
+		if text := strings.TrimSuffix(string(scalar), "\n"); !strings.Contains(text, "\n") {
+			line := []rune(lines[keyNode.Line-1])
+			start := valueNode.Column - 1
+			end := getYAMLScalarEnd(line, start, valueNode.Style)
+			lines[keyNode.Line-1] = string(line[:start]) + text + string(line[end:])
+			return lines, nil
+		}
+	}
+	return replaceYAMLBlock(lines, keyNode, value)
+}
+
+// replaceYAMLBlock replaces the lines of the entry of keyNode with an entry
+// of value
+func replaceYAMLBlock(lines []string, keyNode *yamlv3.Node, value interface{}) ([]string, error) {
+	entry, err := renderYAMLEntry(keyNode.Value, value)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		start  = keyNode.Line - 1
+		indent = keyNode.Column - 1
+		end    = getYAMLEntryEnd(lines, start, indent)
+		// keep what precedes the key, like `- ` of list items
+		prefix   = string([]rune(lines[start])[:indent])
+		replaced []string
+	)
+	for idx, line := range entry {
+		if idx == 0 {
+			replaced = append(replaced, prefix+line)
+		} else {
+			replaced = append(replaced, strings.Repeat(" ", indent)+line)
+		}
+	}
+	return append(lines[:start], append(replaced, lines[end:]...)...), nil
+}
+
+// renderYAMLEntry returns the lines of an entry of key and value
+func renderYAMLEntry(key string, value interface{}) ([]string, error) {
+	var buffer bytes.Buffer
+	encoder := yamlv3.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(map[string]interface{}{key: value}); err != nil {
+		return nil, err
+	}
+	encoder.Close()
+	return strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n"), nil
+}
+
+// getYAMLEntryEnd returns the index of the line following the entry of the
+// key at line start and column indent, leaving out trailing blank lines and
+// comments
+func getYAMLEntryEnd(lines []string, start, indent int) int {
+	end := start + 1
+	for idx := start + 1; idx < len(lines); idx++ {
+		trimmed := strings.TrimSpace(lines[idx])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		lineIndent := len(lines[idx]) - len(strings.TrimLeft(lines[idx], " "))
+		if lineIndent < indent || (lineIndent == indent && !strings.HasPrefix(trimmed, "- ") && trimmed != "-") {
+			break
+		}
+		end = idx + 1
+	}
+	return end
+}
+
+func setYAMLFlowStyle(node *yamlv3.Node) {
+	if node.Kind == yamlv3.MappingNode || node.Kind == yamlv3.SequenceNode {
+		node.Style |= yamlv3.FlowStyle
+	}
+	for _, child := range node.Content {
+		setYAMLFlowStyle(child)
+	}
+}
+
+// getYAMLFlowEnd returns the end of the flow collection starting at start of
+// line, or -1 if it doesn't end on line
+func getYAMLFlowEnd(line []rune, start int) int {
+	var (
+		depth int
+		quote rune
+	)
+	for i := start; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			if depth--; depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// getYAMLScalarEnd returns the end of the scalar of style starting at start
+// of line, before comments
+func getYAMLScalarEnd(line []rune, start int, style yamlv3.Style) int {
+	switch {
+	case style&yamlv3.DoubleQuotedStyle != 0:
+		for i := start + 1; i < len(line); i++ {
+			if line[i] == '\\' {
+				i++
+			} else if line[i] == '"' {
+				return i + 1
+			}
+		}
+	case style&yamlv3.SingleQuotedStyle != 0:
+		for i := start + 1; i < len(line); i++ {
+			if line[i] == '\'' {
+				if i+1 < len(line) && line[i+1] == '\'' {
+					i++
+				} else {
+					return i + 1
+				}
+			}
+		}
+	default:
+		end := len(line)
+		for i := start; i < len(line); i++ {
+			if line[i] == '#' && i > start && (line[i-1] == ' ' || line[i-1] == '\t') {
+				end = i
+				break
+			}
+		}
+		for end > start && (line[end-1] == ' ' || line[end-1] == '\t') {
+			end--
+		}
+		return end
+	}
+	return len(line)
+}
+
+// tomlEntry is a key/value of a TOML document
+type tomlEntry struct {
+	keys []string
+	// line of the key, start of the value in it
+	line, start int
+	// line and end of the value, that may span several lines
+	endLine, end int
+	inArray      bool
+}
+
+// tomlSection is a table of a TOML document, the root table has no keys
+type tomlSection struct {
+	keys  []string
+	array bool
+	// line of the header, -1 for the root table
+	line int
+	// index of the line following the last entry of the table
+	entriesEnd int
+}
+
+// scanTOML returns the entries and tables of TOML lines
+func scanTOML(lines []string) (entries []tomlEntry, sections []tomlSection) {
+	var (
+		section = tomlSection{line: -1, entriesEnd: 0}
+		arrays  []string
+	)
+
+	inArray := func(keys []string) bool {
+		name := strings.Join(keys, ".")
+		for _, array := range arrays {
+			if name == array || strings.HasPrefix(name, array+".") {
+				return true
+			}
+		}
+		return false
+	}
+
+	for idx := 0; idx < len(lines); idx++ {
+		trimmed := strings.TrimSpace(lines[idx])
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+		case strings.HasPrefix(trimmed, "["):
+			sections = append(sections, section)
+
+			array := strings.HasPrefix(trimmed, "[[")
+			header := strings.TrimSpace(strings.SplitN(trimmed, "#", 2)[0])
+			header = strings.TrimSpace(strings.Trim(header, "[]"))
+			section = tomlSection{keys: splitTOMLKeys(header), array: array, line: idx, entriesEnd: idx + 1}
+			if array {
+				arrays = append(arrays, strings.Join(section.keys, "."))
+			}
+		default:
+			equal := findTOMLEqual(lines[idx])
+			if equal < 0 {
+				continue
+			}
+
+			start := equal + 1
+			for start < len(lines[idx]) && (lines[idx][start] == ' ' || lines[idx][start] == '\t') {
+				start++
+			}
+
+			entry := tomlEntry{keys: append(append([]string{}, section.keys...), splitTOMLKeys(lines[idx][:equal])...), line: idx, start: start}
+			entry.endLine, entry.end = getTOMLValueEnd(lines, idx, start)
+			entry.inArray = section.array || inArray(entry.keys)
+			entries = append(entries, entry)
+
+			section.entriesEnd = entry.endLine + 1
+			idx = entry.endLine
+		}
+	}
+	return entries, append(sections, section)
+}
+
+// findTOMLEqual returns the index of the `=` of a key/value line, or -1
+func findTOMLEqual(line string) int {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			return i
+		case c == '#':
+			return -1
+		}
+	}
+	return -1
+}
+
+// splitTOMLKeys splits a dotted TOML key, like `a."b.c"`
+func splitTOMLKeys(key string) []string {
+	var (
+		keys    []string
+		current strings.Builder
+		quote   rune
+	)
+	for _, c := range key {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '.':
+			keys = append(keys, strings.TrimSpace(current.String()))
+			current.Reset()
+		default:
+			current.WriteRune(c)
+		}
+	}
+	return append(keys, strings.TrimSpace(current.String()))
+}
+
+// getTOMLValueEnd returns the line and the end of the value starting at start
+// of line idx, before comments
+func getTOMLValueEnd(lines []string, idx, start int) (endLine, end int) {
+	var (
+		depth int
+		// the delimiter of the string being read
+		delimiter string
+	)
+
+	endLine, end = idx, start
+	for ; idx < len(lines); idx, start = idx+1, 0 {
+		line := lines[idx]
+	scan:
+		for i := start; i < len(line); i++ {
+			switch {
+			case delimiter != "":
+				if line[i] == '\\' && delimiter[0] == '"' {
+					i++
+				} else if strings.HasPrefix(line[i:], delimiter) {
+					i += len(delimiter) - 1
+					delimiter = ""
+				}
+			case line[i] == '#':
+				break scan
+			case strings.HasPrefix(line[i:], `"""`) || strings.HasPrefix(line[i:], `'''`):
+				delimiter = line[i : i+3]
+				i += 2
+			case line[i] == '"' || line[i] == '\'':
+				delimiter = line[i : i+1]
+			case line[i] == '[' || line[i] == '{':
+				depth++
+			case line[i] == ']' || line[i] == '}':
+				depth--
+			}
+
+			if line[i] != ' ' && line[i] != '\t' {
+				endLine, end = idx, i+1
+			}
+		}
+
+		if depth <= 0 && (delimiter == "" || len(delimiter) == 1) {
+			return endLine, end
+		}
+	}
+	return endLine, end
+}
+
+// editTOML writes changes to TOML data, changing lines of their keys only
+func editTOML(data []byte, changes []documentChange) ([]byte, error) {
+	var leaves []documentChange
+	for _, change := range changes {
+		leaves = append(leaves, flattenDocumentChange(change.keys, change.value)...)
+	}
+
+	lines := strings.Split(string(data), "\n")
+	for _, change := range leaves {
+		var err error
+		if lines, err = editTOMLValue(lines, change); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// flattenDocumentChange splits changes of tables into changes of their values
+func flattenDocumentChange(keys []string, value interface{}) []documentChange {
+	m, ok := value.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return []documentChange{{keys: keys, value: value}}
+	}
+
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes []documentChange
+	for _, name := range names {
+		changes = append(changes, flattenDocumentChange(append(append([]string{}, keys...), name), m[name])...)
+	}
+	return changes
+}
+
+func editTOMLValue(lines []string, change documentChange) ([]string, error) {
+	entries, sections := scanTOML(lines)
+	name := strings.Join(change.keys, ".")
+
+	for _, entry := range entries {
+		if entry.inArray {
+			continue
+		}
+
+		entryName := strings.Join(entry.keys, ".")
+		if entryName != name && !strings.HasPrefix(name, entryName+".") {
+			continue
+		}
+
+		value := change.value
+		if entryName != name {
+			// merge into inline tables
+			doc, err := decodeDocument([]byte(strings.Join(lines, "\n")), FormatTOML)
+			if err != nil {
+				return nil, err
+			}
+			existing, _ := lookupDocument(doc, entry.keys)
+			merged, ok := existing.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%v is not a table", entryName)
+			}
+			mergeDocument(merged, nestDocument(change.keys[len(entry.keys):], value).(map[string]interface{}))
+			value = merged
+		}
+
+		text, err := renderTOMLValue(value)
+		if err != nil {
+			return nil, err
+		}
+		line := lines[entry.line][:entry.start] + text + lines[entry.endLine][entry.end:]
+		return append(lines[:entry.line], append([]string{line}, lines[entry.endLine+1:]...)...), nil
+	}
+
+	if tables := documentList(change.value); len(tables) > 0 {
+		return replaceTOMLTables(lines, sections, change)
+	}
+
+	text, err := renderTOMLValue(change.value)
+	if err != nil {
+		return nil, err
+	}
+	line := getTOMLKey(change.keys[len(change.keys)-1]) + " = " + text
+	parent := strings.Join(change.keys[:len(change.keys)-1], ".")
+
+	for _, section := range sections {
+		if section.array || strings.Join(section.keys, ".") != parent {
+			continue
+		}
+
+		insert := section.entriesEnd
+		if section.line < 0 && insert == 0 {
+			// the root table has no entries, insert before the first table
+			if len(sections) == 1 {
+				insert = len(lines)
+				for insert > 0 && strings.TrimSpace(lines[insert-1]) == "" {
+					insert--
+				}
+			} else {
+				insert = sections[1].line
+				for insert > 0 && strings.HasPrefix(strings.TrimSpace(lines[insert-1]), "#") {
+					insert--
+				}
+				line += "\n"
+			}
+		} else if insert > 0 && insert-1 != section.line {
+			// indent like the previous entry
+			line = lines[insert-1][:len(lines[insert-1])-len(strings.TrimLeft(lines[insert-1], " \t"))] + line
+		}
+
+		return append(lines[:insert], append(strings.Split(line, "\n"), lines[insert:]...)...), nil
+	}
+
+	return appendTOMLLines(lines, append([]string{"", "[" + getTOMLTableName(change.keys[:len(change.keys)-1]) + "]"}, line)), nil
+}
+
+// replaceTOMLTables replaces the tables of the array of tables at keys of
+// change, or appends them
+func replaceTOMLTables(lines []string, sections []tomlSection, change documentChange) ([]string, error) {
+	var buffer bytes.Buffer
+	encoder := toml.NewEncoder(&buffer)
+	encoder.Indent = ""
+	if err := encoder.Encode(nestDocument(change.keys, change.value)); err != nil {
+		return nil, err
+	}
+
+	// leave out headers of parent tables, they are defined already
+	var tables []string
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		if strings.HasPrefix(line, "[") && !strings.HasPrefix(line, "[[") {
+			if name := strings.Trim(line, "[]"); strings.HasPrefix(strings.Join(change.keys, "."), name+".") {
+				continue
+			}
+		}
+		tables = append(tables, line)
+	}
+	for len(tables) > 0 && tables[0] == "" {
+		tables = tables[1:]
+	}
+
+	name := strings.Join(change.keys, ".")
+	start, end := -1, -1
+	for _, section := range sections {
+		sectionName := strings.Join(section.keys, ".")
+		if start < 0 {
+			if section.array && sectionName == name {
+				start = section.line
+			}
+			continue
+		}
+
+		if !(section.array && sectionName == name) && !strings.HasPrefix(sectionName, name+".") {
+			end = section.line
+			break
+		}
+	}
+
+	if start < 0 {
+		return appendTOMLLines(lines, append([]string{""}, tables...)), nil
+	}
+
+	if end < 0 {
+		end = len(lines)
+	}
+	// keep blank lines and comments preceding the next table
+	for end > start && (strings.TrimSpace(lines[end-1]) == "" || strings.HasPrefix(strings.TrimSpace(lines[end-1]), "#")) {
+		end--
+	}
+	return append(lines[:start], append(tables, lines[end:]...)...), nil
+}
+
+// appendTOMLLines appends added lines at the end of lines
+func appendTOMLLines(lines, added []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 && len(added) > 0 && added[0] == "" {
+		added = added[1:]
+	}
+	return append(append(lines, added...), "")
+}
+
+// renderTOMLValue returns value as an inline TOML value
+func renderTOMLValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var names []string
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var values []string
+		for _, name := range names {
+			text, err := renderTOMLValue(v[name])
+			if err != nil {
+				return "", err
+			}
+			values = append(values, getTOMLKey(name)+" = "+text)
+		}
+		return "{" + strings.Join(values, ", ") + "}", nil
+	case []map[string]interface{}, []interface{}:
+		if tables := documentList(v); len(tables) > 0 {
+			var values []string
+			for _, table := range tables {
+				text, err := renderTOMLValue(table)
+				if err != nil {
+					return "", err
+				}
+				values = append(values, text)
+			}
+			return "[" + strings.Join(values, ", ") + "]", nil
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := toml.NewEncoder(&buffer).Encode(map[string]interface{}{"v": value}); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimPrefix(buffer.String(), "v = ")), nil
+}
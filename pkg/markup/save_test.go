@@ -0,0 +1,292 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+type saveConfig struct {
+	APPName string
+	Hosts   []string
+	DB      struct {
+		Name     string
+		Port     int
+		User     string
+		Password string
+	}
+	Contacts []struct {
+		Name  string
+		Email string
+	}
+}
+
+func TestSave(t *testing.T) {
+	for _, c := range []struct {
+		ext, content, expected string
+	}{
+		{
+			ext:      "yml",
+			content:  "# application\nappname: \"app\" # name\nhosts: [a, b]\n\ndb:\n  name: dev # database\n  port: 3306\n\n# contacts\ncontacts:\n  - name: admin\n    email: admin@example.com\n",
+			expected: "# application\nappname: \"new app\" # name\nhosts: [a, b, c]\n\ndb:\n  name: dev # database\n  port: 5432\n  user: root\n\n# contacts\ncontacts:\n  - name: admin\n    email: admin@example.com\n",
+		},
+		{
+			ext:      "toml",
+			content:  "# application\nappname = \"app\" # name\nhosts = [\"a\", \"b\"]\n\n[db]\n  name = \"dev\" # database\n  port = 3306\n\n# contacts\n[[contacts]]\nname = \"admin\"\nemail = \"admin@example.com\"\n",
+			expected: "# application\nappname = \"new app\" # name\nhosts = [\"a\", \"b\", \"c\"]\n\n[db]\n  name = \"dev\" # database\n  port = 5432\n  user = \"root\"\n\n# contacts\n[[contacts]]\nname = \"admin\"\nemail = \"admin@example.com\"\n",
+		},
+	} {
+		file, err := ioutil.TempFile("/tmp", "configure.*."+c.ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		file.WriteString(c.content)
+		file.Close()
+		os.Chmod(file.Name(), 0640)
+
+		var config saveConfig
+		configure := New(&Config{ENVPrefix: "SAVE1"})
+		if err := configure.Load(&config, file.Name()); err != nil {
+			t.Fatal(err)
+		}
+
+		config.APPName = "new app"
+		config.Hosts = append(config.Hosts, "c")
+		config.DB.Port = 5432
+		config.DB.User = "root"
+		if err := configure.Save(&config, file.Name()); err != nil {
+			t.Errorf("No error should happen when saving %v, but got %v", c.ext, err)
+		}
+
+		if data, _ := ioutil.ReadFile(file.Name()); string(data) != c.expected {
+			t.Errorf("%v should only be changed at changed values, but got\n%s", c.ext, data)
+		}
+
+		if info, err := os.Stat(file.Name()); err != nil || info.Mode().Perm() != 0640 {
+			t.Errorf("mode of %v should be kept, but got %v", c.ext, info.Mode())
+		}
+
+		var saved saveConfig
+		if err := New(&Config{ENVPrefix: "SAVE1"}).Load(&saved, file.Name()); err != nil || saved.APPName != "new app" || saved.DB.Port != 5432 || len(saved.Hosts) != 3 || len(saved.Contacts) != 1 {
+			t.Errorf("saved %v should be loaded, but got %+v, %v", c.ext, saved, err)
+		}
+
+		config.Contacts = append(config.Contacts, config.Contacts[0])
+		config.Contacts[1].Name = "support"
+		if err := configure.Save(&config, file.Name()); err != nil {
+			t.Errorf("No error should happen when saving lists of %v, but got %v", c.ext, err)
+		}
+
+		saved = saveConfig{}
+		if err := New(&Config{ENVPrefix: "SAVE1"}).Load(&saved, file.Name()); err != nil || len(saved.Contacts) != 2 || saved.Contacts[1].Name != "support" {
+			t.Errorf("saved lists of %v should be loaded, but got %+v, %v", c.ext, saved, err)
+		}
+
+		if data, _ := ioutil.ReadFile(file.Name()); !strings.HasPrefix(string(data), "# application\n") || !strings.Contains(string(data), "# database") {
+			t.Errorf("comments of %v should be kept, but got\n%s", c.ext, data)
+		}
+	}
+}
+
+func TestSaveRefuseENV(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("appname: app\n")
+	file.Close()
+
+	os.Setenv("SAVE2_DB_PASSWORD", "secret")
+	defer os.Unsetenv("SAVE2_DB_PASSWORD")
+
+	var config saveConfig
+	configure := New(&Config{ENVPrefix: "SAVE2", SetValues: []string{"db.name=flag"}})
+	if err := configure.Save(&config, file.Name()); err == nil {
+		t.Errorf("Error should happen when saving a configuration that has not been loaded")
+	}
+
+	if err := configure.Load(&config, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	// values from env and set values are not written when not changed
+	config.APPName = "new app"
+	if err := configure.Save(&config, file.Name()); err != nil {
+		t.Errorf("No error should happen when saving, but got %v", err)
+	}
+	if data, _ := ioutil.ReadFile(file.Name()); string(data) != "appname: new app\n" {
+		t.Errorf("values from env and set values should not be saved, but got %s", data)
+	}
+
+	config.DB.Password = "changed"
+	if err := configure.Save(&config, file.Name()); err == nil || !strings.Contains(err.Error(), "DB.Password is set by env") {
+		t.Errorf("Error should happen when saving a changed value from env, but got %v", err)
+	}
+
+	config.DB.Password = "secret"
+	config.DB.Name = "changed"
+	if err := configure.Save(&config, file.Name()); err == nil || !strings.Contains(err.Error(), "DB.Name is set by set") {
+		t.Errorf("Error should happen when saving a changed set value, but got %v", err)
+	}
+}
+
+type secretSaveConfig struct {
+	DB struct {
+		Password string `secret:"true"`
+		Token    string
+	}
+}
+
+func TestSaveSecrets(t *testing.T) {
+	provider := newTestKeyProvider(t, "k1")
+	envelope, err := EncryptValue(provider, "old-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ext, content := range map[string]string{
+		"yml":  "db:\n  password: old-password\n  token: " + envelope + "\n",
+		"toml": "[db]\npassword = \"old-password\"\ntoken = \"" + envelope + "\"\n",
+		"json": "{\"db\": {\"password\": \"old-password\", \"token\": \"" + envelope + "\"}}\n",
+	} {
+		file, err := ioutil.TempFile("/tmp", "configure.*."+ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		file.WriteString(content)
+		file.Close()
+
+		var config secretSaveConfig
+		configure := New(&Config{ENVPrefix: "SAVE3", KeyProvider: provider})
+		if err := configure.Load(&config, file.Name()); err != nil {
+			t.Fatal(err)
+		}
+
+		config.DB.Password = "new-password"
+		config.DB.Token = "new-token"
+		if err := configure.Save(&config, file.Name()); err != nil {
+			t.Errorf("No error should happen when saving secrets of %v, but got %v", ext, err)
+		}
+
+		if data, _ := ioutil.ReadFile(file.Name()); strings.Contains(string(data), "new-") || strings.Count(string(data), "ENC[") != 2 {
+			t.Errorf("secrets of %v should be saved encrypted, but got\n%s", ext, data)
+		}
+
+		var saved secretSaveConfig
+		if err := New(&Config{ENVPrefix: "SAVE3", KeyProvider: provider}).Load(&saved, file.Name()); err != nil || saved != config {
+			t.Errorf("saved secrets of %v should be loaded, but got %+v, %v", ext, saved, err)
+		}
+	}
+}
+
+func TestSaveRefuseSecretsWithoutKeys(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("db:\n  password: old-password\n")
+	file.Close()
+
+	var config secretSaveConfig
+	configure := New(&Config{ENVPrefix: "SAVE4"})
+	if err := configure.Load(&config, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	config.DB.Password = "new-password"
+	if err := configure.Save(&config, file.Name()); err == nil || !strings.Contains(err.Error(), "db.password is secret") {
+		t.Errorf("Error should happen when saving secrets without keys, but got %v", err)
+	}
+
+	if data, _ := ioutil.ReadFile(file.Name()); string(data) != "db:\n  password: old-password\n" {
+		t.Errorf("file should not be changed when secrets can't be saved, but got %s", data)
+	}
+}
+
+func TestSaveKeepsJSONNumbers(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("{\"id\": 9007199254740993, \"name\": \"app\"}\n")
+	file.Close()
+
+	var config struct {
+		ID   uint64
+		Name string
+	}
+	configure := New(&Config{ENVPrefix: "SAVE5"})
+	if err := configure.Load(&config, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Name = "new app"
+	if err := configure.Save(&config, file.Name()); err != nil {
+		t.Errorf("No error should happen when saving, but got %v", err)
+	}
+
+	if data, _ := ioutil.ReadFile(file.Name()); !strings.Contains(string(data), "9007199254740993") {
+		t.Errorf("numbers should be kept when saving json, but got %s", data)
+	}
+}
+
+// readOnlyFileSystem reads files of the process, but can't write them
+type readOnlyFileSystem struct{}
+
+func (readOnlyFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (readOnlyFileSystem) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+func TestSaveRefuseReadOnlyFileSystem(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("appname: app\n")
+	file.Close()
+
+	var config saveConfig
+	configure := New(&Config{ENVPrefix: "SAVE6", FileSystem: readOnlyFileSystem{}})
+	if err := configure.Load(&config, file.Name()); err != nil || config.APPName != "app" {
+		t.Fatalf("configuration should be loaded, but got %+v, %v", config, err)
+	}
+
+	config.APPName = "new app"
+	if err := configure.Save(&config, file.Name()); err == nil || !strings.Contains(err.Error(), "read only") {
+		t.Errorf("Error should happen when saving to a read only file system, but got %v", err)
+	}
+
+	if data, _ := ioutil.ReadFile(file.Name()); string(data) != "appname: app\n" {
+		t.Errorf("file should not be changed, but got %s", data)
+	}
+}
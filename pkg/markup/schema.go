@@ -0,0 +1,299 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SchemaVersion is the JSON Schema dialect of generated schemas
+const SchemaVersion = "https://json-schema.org/draft/2020-12/schema"
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// GenerateSchema writes a JSON Schema of config to w, using the key names of
+// format for properties. Fields' `default`, `required` and `validate` tags are
+// converted into schema keywords, and their env variables are listed in `x-env`
+func (configure *Configure) GenerateSchema(w io.Writer, config interface{}, format string) error {
+	configType := reflect.TypeOf(config)
+	for configType.Kind() == reflect.Ptr {
+		configType = configType.Elem()
+	}
+
+	var prefixes []string
+	if prefix := configure.getENVPrefix(config); prefix != "-" {
+		prefixes = []string{prefix}
+	}
+
+	generator := &schemaGenerator{configure: configure, format: format, definitions: map[string]interface{}{}, visiting: map[reflect.Type]bool{}}
+	schema := generator.typeSchema(configType, prefixes, true)
+	schema["$schema"] = SchemaVersion
+	if configType.Name() != "" {
+		schema["title"] = configType.Name()
+	}
+	if len(generator.definitions) > 0 {
+		schema["$defs"] = generator.definitions
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(schema)
+}
+
+// GenerateSchema writes a JSON Schema of config to w, see Configure.GenerateSchema
+func GenerateSchema(w io.Writer, config interface{}, format string) error {
+	return New(nil).GenerateSchema(w, config, format)
+}
+
+type schemaGenerator struct {
+	configure   *Configure
+	format      string
+	definitions map[string]interface{}
+	visiting    map[reflect.Type]bool
+}
+
+// typeSchema returns the schema of t, whose fields are loaded from env
+// variables nested under prefixes if withENV is true
+func (generator *schemaGenerator) typeSchema(t reflect.Type, prefixes []string, withENV bool) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == durationType:
+		return map[string]interface{}{"type": []string{"string", "integer"}}
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() != reflect.Struct && reflect.PtrTo(t).Implements(textUnmarshalerType):
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string"}
+		}
+		return map[string]interface{}{"type": "array", "items": generator.typeSchema(t.Elem(), append(prefixes, "{N}"), withENV)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": generator.typeSchema(t.Elem(), nil, false)}
+	case reflect.Struct:
+		if generator.visiting[t] {
+			// recursive types are defined once, without env variables as
+			// they are different for every level
+			if _, ok := generator.definitions[t.Name()]; !ok {
+				generator.definitions[t.Name()] = map[string]interface{}{}
+				delete(generator.visiting, t)
+				generator.definitions[t.Name()] = generator.typeSchema(t, nil, false)
+				generator.visiting[t] = true
+			}
+			return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+		}
+
+		generator.visiting[t] = true
+		defer delete(generator.visiting, t)
+		return generator.structSchema(t, prefixes, withENV)
+	}
+	return map[string]interface{}{}
+}
+
+func (generator *schemaGenerator) structSchema(t reflect.Type, prefixes []string, withENV bool) map[string]interface{} {
+	var (
+		properties = map[string]interface{}{}
+		required   []string
+	)
+
+	generator.addProperties(t, prefixes, withENV, properties, &required)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (generator *schemaGenerator) addProperties(t reflect.Type, prefixes []string, withENV bool, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		fieldStruct := t.Field(i)
+		if fieldStruct.PkgPath != "" && !fieldStruct.Anonymous {
+			continue
+		}
+
+		key, inline := documentKey(&fieldStruct, generator.format)
+		if key == "-" {
+			continue
+		}
+
+		fieldType := fieldStruct.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if inline {
+			generator.addProperties(fieldType, generator.configure.getPrefixForStruct(prefixes, &fieldStruct), withENV, properties, required)
+			continue
+		}
+
+		isRequired := fieldStruct.Tag.Get("required") == "true"
+		schema := generator.typeSchema(fieldType, generator.configure.getPrefixForStruct(prefixes, &fieldStruct), withENV)
+		if _, ok := schema["$ref"]; !ok {
+			if value := fieldStruct.Tag.Get("default"); value != "" {
+				if defaultValue, ok := getSchemaDefault(fieldType, value); ok {
+					schema["default"] = defaultValue
+				}
+			}
+
+			if withENV {
+				if envNames := generator.configure.getENVNames(prefixes, &fieldStruct); len(envNames) > 0 {
+					schema["x-env"] = envNames
+				}
+			}
+
+			if addValidateKeywords(schema, fieldType, fieldStruct.Tag.Get("validate")) {
+				isRequired = true
+			}
+		}
+
+		properties[key] = schema
+		if isRequired {
+			*required = append(*required, key)
+		}
+	}
+}
+
+// getSchemaDefault decodes a `default` tag into a value of t, and converts it
+// to a JSON value
+func getSchemaDefault(t reflect.Type, value string) (interface{}, bool) {
+	defaultValue := reflect.New(t)
+	if err := yaml.Unmarshal([]byte(value), defaultValue.Interface()); err != nil {
+		return nil, false
+	}
+	return getSchemaValue(defaultValue.Elem())
+}
+
+func getSchemaValue(value reflect.Value) (interface{}, bool) {
+	if value.Type() == durationType {
+		return value.Interface().(time.Duration).String(), true
+	}
+
+	switch value.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return value.Interface(), true
+	case reflect.Slice, reflect.Array:
+		results := []interface{}{}
+		for i := 0; i < value.Len(); i++ {
+			result, ok := getSchemaValue(value.Index(i))
+			if !ok {
+				return nil, false
+			}
+			results = append(results, result)
+		}
+		return results, true
+	}
+	return nil, false
+}
+
+// addValidateKeywords converts rules of a `validate` tag, like
+// `validate:"min=1,max=10"`, into schema keywords, and returns whether the
+// field is required. Unknown rules are ignored
+func addValidateKeywords(schema map[string]interface{}, t reflect.Type, rules string) (required bool) {
+	if rules == "" {
+		return false
+	}
+
+	var minKey, maxKey string
+	switch t.Kind() {
+	case reflect.String:
+		minKey, maxKey = "minLength", "maxLength"
+	case reflect.Slice, reflect.Array:
+		minKey, maxKey = "minItems", "maxItems"
+	case reflect.Map:
+		minKey, maxKey = "minProperties", "maxProperties"
+	default:
+		minKey, maxKey = "minimum", "maximum"
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		parts := strings.SplitN(rule, "=", 2)
+		name, param := parts[0], ""
+		if len(parts) == 2 {
+			param = parts[1]
+		}
+
+		number, err := strconv.ParseFloat(param, 64)
+		isNumber := err == nil
+
+		switch {
+		case name == "required":
+			required = true
+		case name == "min" && isNumber, name == "gte" && isNumber:
+			schema[minKey] = number
+		case name == "max" && isNumber, name == "lte" && isNumber:
+			schema[maxKey] = number
+		case name == "gt" && isNumber && minKey == "minimum":
+			schema["exclusiveMinimum"] = number
+		case name == "lt" && isNumber && maxKey == "maximum":
+			schema["exclusiveMaximum"] = number
+		case name == "len" && isNumber:
+			schema[minKey], schema[maxKey] = number, number
+		case name == "oneof":
+			var values []interface{}
+			for _, value := range strings.Fields(param) {
+				if enum, ok := getSchemaDefault(t, value); ok {
+					values = append(values, enum)
+				}
+			}
+			schema["enum"] = values
+		case name == "email":
+			schema["format"] = "email"
+		case name == "url", name == "uri":
+			schema["format"] = "uri"
+		case name == "hostname":
+			schema["format"] = "hostname"
+		case name == "ipv4", name == "ipv6":
+			schema["format"] = name
+		}
+	}
+	return required
+}
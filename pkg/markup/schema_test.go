@@ -0,0 +1,81 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateSchema(t *testing.T) {
+	type schemaConfig struct {
+		testConfig `yaml:",inline"`
+		Level      string `yaml:"log_level" default:"info" validate:"oneof=debug info warn"`
+		Workers    int    `validate:"min=1,max=64"`
+		Menus      []Menu
+	}
+
+	var buffer bytes.Buffer
+	if err := New(&Config{ENVPrefix: "SCHEMA1"}).GenerateSchema(&buffer, &schemaConfig{}, FormatYAML); err != nil {
+		t.Fatalf("No error should happen when generate schema, but got %v", err)
+	}
+
+	var schema map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &schema); err != nil {
+		t.Fatalf("schema should be valid json, but got %v", err)
+	}
+
+	properties := schema["properties"].(map[string]interface{})
+	if _, ok := properties["appname"]; !ok {
+		t.Errorf("inlined struct fields should be properties, but got %v", properties)
+	}
+
+	level := properties["log_level"].(map[string]interface{})
+	if level["default"] != "info" || !reflect.DeepEqual(level["enum"], []interface{}{"debug", "info", "warn"}) {
+		t.Errorf("default and validate tags should be converted, but got %v", level)
+	}
+
+	if workers := properties["workers"].(map[string]interface{}); workers["minimum"] != 1.0 || workers["maximum"] != 64.0 {
+		t.Errorf("validate tag should be converted to minimum and maximum, but got %v", workers)
+	}
+
+	db := properties["db"].(map[string]interface{})
+	if !reflect.DeepEqual(db["required"], []interface{}{"password"}) {
+		t.Errorf("required fields should be listed, but got %v", db["required"])
+	}
+
+	password := db["properties"].(map[string]interface{})["password"].(map[string]interface{})
+	if !reflect.DeepEqual(password["x-env"], []interface{}{"DBPassword"}) {
+		t.Errorf("env variables should be listed, but got %v", password["x-env"])
+	}
+
+	email := properties["contacts"].(map[string]interface{})["items"].(map[string]interface{})["properties"].(map[string]interface{})["email"].(map[string]interface{})
+	if !reflect.DeepEqual(email["x-env"], []interface{}{"SCHEMA1_testConfig_Contacts_{N}_Email", "SCHEMA1_TESTCONFIG_CONTACTS_{N}_EMAIL"}) {
+		t.Errorf("env variables of slice elements should be listed, but got %v", email["x-env"])
+	}
+
+	children := properties["menus"].(map[string]interface{})["items"].(map[string]interface{})["properties"].(map[string]interface{})["children"].(map[string]interface{})
+	if children["items"].(map[string]interface{})["$ref"] != "#/$defs/Menu" || schema["$defs"].(map[string]interface{})["Menu"] == nil {
+		t.Errorf("recursive types should be referenced, but got %v", children)
+	}
+}
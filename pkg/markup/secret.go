@@ -0,0 +1,344 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EncryptionAlgorithm is the algorithm of encrypted value envelopes
+const EncryptionAlgorithm = "aes256-gcm"
+
+// encryptedValueRegexp matches envelopes like `ENC[aes256-gcm,<key id>,<base64 nonce and ciphertext>]`
+var encryptedValueRegexp = regexp.MustCompile(`ENC\[([^,\]]+),([^,\]]*),([A-Za-z0-9+/=]+)\]`)
+
+// KeyProvider provides the keys used to encrypt and decrypt values in
+// configuration files
+type KeyProvider interface {
+	// KeyIDs returns the IDs of available keys, the first one is used to
+	// encrypt values
+	KeyIDs() []string
+	// Key returns the key with id
+	Key(id string) ([]byte, error)
+}
+
+// LocalKeyProvider provides keys read from a keyfile or an env variable
+type LocalKeyProvider struct {
+	ids  []string
+	keys map[string][]byte
+}
+
+// KeyIDs returns the IDs of available keys, in the order they were read
+func (provider *LocalKeyProvider) KeyIDs() []string {
+	return provider.ids
+}
+
+// Key returns the key with id
+func (provider *LocalKeyProvider) Key(id string) ([]byte, error) {
+	if key, ok := provider.keys[id]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %v", id)
+}
+
+// ParseKeys parses keys in the format `<id>:<base64 key>`, separated by
+// newlines or commas. Lines starting with # are ignored. Keys should be 32
+// bytes long
+func ParseKeys(text string) (*LocalKeyProvider, error) {
+	provider := &LocalKeyProvider{keys: map[string][]byte{}}
+
+	scanner := bufio.NewScanner(strings.NewReader(strings.Replace(text, ",", "\n", -1)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid key %q, should be <id>:<base64 key>", line)
+		}
+
+		id := strings.TrimSpace(parts[0])
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %v, got %v", id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("invalid key %v, should be 32 bytes long for %v", id, EncryptionAlgorithm)
+		}
+
+		if _, ok := provider.keys[id]; !ok {
+			provider.ids = append(provider.ids, id)
+		}
+		provider.keys[id] = key
+	}
+
+	if len(provider.ids) == 0 {
+		return nil, errors.New("no keys found")
+	}
+	return provider, scanner.Err()
+}
+
+// LoadKeyFile reads keys from file, see ParseKeys for its format
+func LoadKeyFile(file string) (*LocalKeyProvider, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeys(string(data))
+}
+
+// DefaultKeyProvider reads keys from env `CONFIGURE_SECRET_KEYS`, or from the
+// keyfile set by env `CONFIGURE_SECRET_KEYFILE`
+func DefaultKeyProvider() (KeyProvider, error) {
+	return New(nil).getDefaultKeyProvider()
+}
+
+func (configure *Configure) getDefaultKeyProvider() (KeyProvider, error) {
+	if keys := configure.getenv("CONFIGURE_SECRET_KEYS"); keys != "" {
+		return ParseKeys(keys)
+	}
+
+	if file := configure.getenv("CONFIGURE_SECRET_KEYFILE"); file != "" {
+		data, err := configure.readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return ParseKeys(string(data))
+	}
+	return nil, errors.New("no keys to decrypt values, set CONFIGURE_SECRET_KEYS or CONFIGURE_SECRET_KEYFILE")
+}
+
+// IsEncryptedValue reports whether value is an encrypted value envelope
+func IsEncryptedValue(value string) bool {
+	match := encryptedValueRegexp.FindStringIndex(value)
+	return match != nil && match[0] == 0 && match[1] == len(value)
+}
+
+// EncryptValue encrypts value with the first key of provider, and returns
+// its envelope
+func EncryptValue(provider KeyProvider, value string) (string, error) {
+	ids := provider.KeyIDs()
+	if len(ids) == 0 {
+		return "", errors.New("no keys to encrypt value")
+	}
+
+	key, err := provider.Key(ids[0])
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	data := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return fmt.Sprintf("ENC[%v,%v,%v]", EncryptionAlgorithm, ids[0], base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// DecryptValue decrypts an encrypted value envelope. The key the value was
+// encrypted with is tried first, then every other key of provider, so that
+// values keep working while keys are rotated
+func DecryptValue(provider KeyProvider, value string) (string, error) {
+	match := encryptedValueRegexp.FindStringSubmatch(value)
+	if match == nil || match[0] != value {
+		return "", errors.New("invalid encrypted value")
+	}
+
+	if match[1] != EncryptionAlgorithm {
+		return "", fmt.Errorf("unsupported encryption algorithm %v", match[1])
+	}
+
+	data, err := base64.StdEncoding.DecodeString(match[3])
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value, got %v", err)
+	}
+
+	ids := []string{match[2]}
+	for _, id := range provider.KeyIDs() {
+		if id != match[2] {
+			ids = append(ids, id)
+		}
+	}
+
+	for _, id := range ids {
+		key, err := provider.Key(id)
+		if err != nil {
+			continue
+		}
+
+		gcm, err := newGCM(key)
+		if err != nil || len(data) < gcm.NonceSize() {
+			continue
+		}
+
+		if plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil); err == nil {
+			return string(plaintext), nil
+		}
+	}
+	return "", fmt.Errorf("failed to decrypt value encrypted with key %v", match[2])
+}
+
+// RotateValues re-encrypts every encrypted value envelope in data with the
+// first key of provider, leaving the rest of data untouched
+func RotateValues(provider KeyProvider, data []byte) ([]byte, error) {
+	var err error
+	result := encryptedValueRegexp.ReplaceAllFunc(data, func(envelope []byte) []byte {
+		if err != nil {
+			return envelope
+		}
+
+		var value string
+		if value, err = DecryptValue(provider, string(envelope)); err != nil {
+			return envelope
+		}
+
+		if value, err = EncryptValue(provider, value); err != nil {
+			return envelope
+		}
+		return []byte(value)
+	})
+	return result, err
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func hasEncryptedValues(data []byte) bool {
+	return encryptedValueRegexp.Match(data)
+}
+
+func (configure *Configure) getKeyProvider() (KeyProvider, error) {
+	if configure.Config.KeyProvider != nil {
+		return configure.Config.KeyProvider, nil
+	}
+	return configure.getDefaultKeyProvider()
+}
+
+// decryptDocument decrypts encrypted values in doc, decoded into a value of
+// t, or nil if it is unknown. Changes are appended to edits if it isn't nil
+func (configure *Configure) decryptDocument(file string, t reflect.Type, doc map[string]interface{}, format string, edits *[]documentEdit) error {
+	var provider KeyProvider
+
+	var decrypt func(value interface{}, t reflect.Type, keys []interface{}) (interface{}, error)
+	decrypt = func(value interface{}, t reflect.Type, keys []interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case string:
+			if !IsEncryptedValue(v) {
+				return v, nil
+			}
+
+			if provider == nil {
+				var err error
+				if provider, err = configure.getKeyProvider(); err != nil {
+					return nil, err
+				}
+			}
+
+			plaintext, err := DecryptValue(provider, v)
+			if err != nil {
+				return nil, err
+			}
+
+			result := getDecryptedValue(plaintext, t)
+			if edits != nil {
+				*edits = append(*edits, documentEdit{keys: keys, value: result})
+			}
+			return result, nil
+		case map[string]interface{}:
+			for key, elem := range v {
+				result, err := decrypt(elem, documentFieldType(t, key, format), appendKey(keys, key))
+				if err != nil {
+					return nil, fmt.Errorf("%v: %v", key, err)
+				}
+				v[key] = result
+			}
+		case []interface{}:
+			for i, elem := range v {
+				result, err := decrypt(elem, documentFieldType(t, i, format), appendKey(keys, i))
+				if err != nil {
+					return nil, fmt.Errorf("[%v]: %v", i, err)
+				}
+				v[i] = result
+			}
+		case []map[string]interface{}:
+			for i, elem := range v {
+				if _, err := decrypt(elem, documentFieldType(t, i, format), appendKey(keys, i)); err != nil {
+					return nil, fmt.Errorf("[%v]: %v", i, err)
+				}
+			}
+		}
+		return value, nil
+	}
+
+	if _, err := decrypt(doc, t, nil); err != nil {
+		return fmt.Errorf("%v: %v", file, err)
+	}
+	return nil
+}
+
+// getDecryptedValue returns plaintext as a value of a document tree, decoded
+// into a value of t. It is parsed as a YAML scalar, so that numbers, bools or
+// durations can be encrypted, unless t is a string
+func getDecryptedValue(plaintext string, t reflect.Type) interface{} {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t != nil && (t.Kind() == reflect.String || reflect.PtrTo(t).Implements(textUnmarshalerType)) {
+		return plaintext
+	}
+
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(plaintext), &value); err != nil {
+		return plaintext
+	}
+
+	switch value.(type) {
+	case bool, int, int64, uint64, float64:
+		return value
+	}
+	return plaintext
+}
@@ -0,0 +1,141 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestKeyProvider(t *testing.T, ids ...string) *LocalKeyProvider {
+	var keys string
+	for _, id := range ids {
+		key := sha256.Sum256([]byte(id))
+		keys += fmt.Sprintf("%v:%v\n", id, base64.StdEncoding.EncodeToString(key[:]))
+	}
+
+	provider, err := ParseKeys(keys)
+	if err != nil {
+		t.Fatalf("No error should happen when parse keys, but got %v", err)
+	}
+	return provider
+}
+
+func TestEncryptAndRotateValue(t *testing.T) {
+	oldProvider := newTestKeyProvider(t, "old")
+	envelope, err := EncryptValue(oldProvider, "db_password")
+	if err != nil || !IsEncryptedValue(envelope) {
+		t.Fatalf("should encrypt value into an envelope, but got %v, %v", envelope, err)
+	}
+
+	if value, err := DecryptValue(oldProvider, envelope); err != nil || value != "db_password" {
+		t.Errorf("should decrypt value, but got %v, %v", value, err)
+	}
+
+	newProvider := newTestKeyProvider(t, "new", "old")
+	data, err := RotateValues(newProvider, []byte("password = \""+envelope+"\" # comment\n"))
+	if err != nil {
+		t.Fatalf("No error should happen when rotate values, but got %v", err)
+	}
+
+	rotated := encryptedValueRegexp.FindString(string(data))
+	if !bytes.HasPrefix(data, []byte(`password = "ENC[aes256-gcm,new,`)) || !bytes.HasSuffix(data, []byte("\" # comment\n")) {
+		t.Errorf("value should be encrypted with the new key in place, but got %s", data)
+	}
+
+	if _, err := DecryptValue(oldProvider, rotated); err == nil {
+		t.Errorf("Should get error when decrypt value with a removed key")
+	}
+
+	if value, err := DecryptValue(newTestKeyProvider(t, "new"), rotated); err != nil || value != "db_password" {
+		t.Errorf("should decrypt rotated value, but got %v, %v", value, err)
+	}
+}
+
+func TestLoadEncryptedValue(t *testing.T) {
+	provider := newTestKeyProvider(t, "k1")
+	envelope, _ := EncryptValue(provider, "db_password")
+
+	file, err := ioutil.TempFile("/tmp", "bhojpur*.yml")
+	if err != nil {
+		t.Fatal("Could not create temp file")
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	file.WriteString("db:\n  name: bhojpur\n  password: " + envelope + "\ncontacts:\n- email: " + envelope + "\n")
+
+	var result testConfig
+	if err := New(&Config{ENVPrefix: "SECRET1", KeyProvider: provider}).Load(&result, file.Name()); err != nil {
+		t.Fatalf("No error should happen when load configurations, but got %v", err)
+	}
+
+	if result.DB.Password != "db_password" || result.Contacts[0].Email != "db_password" {
+		t.Errorf("encrypted values should be decrypted, but got %+v", result)
+	}
+
+	if err := New(&Config{ENVPrefix: "SECRET1", KeyProvider: newTestKeyProvider(t, "k2")}).Load(&result, file.Name()); err == nil {
+		t.Errorf("Should get error when load configurations without the key")
+	}
+}
+
+type typedSecretConfig struct {
+	Port    int
+	Debug   bool
+	Timeout time.Duration
+	PIN     string
+}
+
+func TestLoadEncryptedTypedValues(t *testing.T) {
+	provider := newTestKeyProvider(t, "k1")
+	encrypt := func(value string) string {
+		envelope, _ := EncryptValue(provider, value)
+		return envelope
+	}
+
+	for ext, content := range map[string]string{
+		".yml":  fmt.Sprintf("port: %v\ndebug: %v\ntimeout: %v\npin: %v\n", encrypt("5432"), encrypt("true"), encrypt("5s"), encrypt("1234")),
+		".json": fmt.Sprintf(`{"Port": "%v", "Debug": "%v", "Timeout": "%v", "PIN": "%v"}`, encrypt("5432"), encrypt("true"), encrypt("5000000000"), encrypt("1234")),
+		".toml": fmt.Sprintf("Port = \"%v\"\nDebug = \"%v\"\nTimeout = \"%v\"\nPIN = \"%v\"\n", encrypt("5432"), encrypt("true"), encrypt("5000000000"), encrypt("1234")),
+	} {
+		file, err := ioutil.TempFile("/tmp", "bhojpur*"+ext)
+		if err != nil {
+			t.Fatal("Could not create temp file")
+		}
+		defer os.Remove(file.Name())
+		file.WriteString(content)
+		file.Close()
+
+		var result typedSecretConfig
+		if err := New(&Config{ENVPrefix: "SECRET3", KeyProvider: provider}).Load(&result, file.Name()); err != nil {
+			t.Fatalf("No error should happen when load encrypted %v values, but got %v", ext, err)
+		}
+
+		if result.Port != 5432 || !result.Debug || result.Timeout != 5*time.Second || result.PIN != "1234" {
+			t.Errorf("encrypted %v values should be decoded into their types, but got %+v", ext, result)
+		}
+	}
+}
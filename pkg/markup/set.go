@@ -0,0 +1,88 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SourceSet is the source of values assigned with Config.SetValues, followed
+// by their paths, e.g. `set:contacts[0].email`
+const SourceSet = "set"
+
+// setValue is an assignment of Config.SetValues
+type setValue struct {
+	path  string
+	value string
+}
+
+// parseSetValues parses assignments like `path=value`, or `path=@file` to
+// assign the content of file
+func (configure *Configure) parseSetValues(assignments []string) ([]setValue, error) {
+	var results []setValue
+	for _, assignment := range assignments {
+		idx := strings.Index(assignment, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid set value %v, should be path=value", assignment)
+		}
+
+		path, value := strings.TrimSpace(assignment[:idx]), assignment[idx+1:]
+		if strings.HasPrefix(value, "@") {
+			content, err := configure.readFile(value[1:])
+			if err != nil {
+				return nil, fmt.Errorf("failed to read set value %v: %w", path, err)
+			}
+			value = strings.TrimSuffix(string(content), "\n")
+		}
+		results = append(results, setValue{path: path, value: value})
+	}
+	return results, nil
+}
+
+// applySetValues assigns Config.SetValues to config in order, slices are
+// grown to hold their indexes, and records their sources
+func (configure *Configure) applySetValues(config interface{}, recorder *sourceRecorder) error {
+	setValues, err := configure.parseSetValues(configure.Config.SetValues)
+	if err != nil {
+		return err
+	}
+
+	for _, setValue := range setValues {
+		if _, _, err := setPath(reflect.ValueOf(config).Elem(), setValue.path, setValue.value, true); err != nil {
+			return fmt.Errorf("failed to set %v: %w", setValue.path, err)
+		}
+		recorder.record(SourceSet + ":" + setValue.path)
+	}
+	return nil
+}
+
+// applyAssignments applies Config.SetValues, then overrides set with Set
+func (configure *Configure) applyAssignments(config interface{}, recorder *sourceRecorder) error {
+	if err := configure.applySetValues(config, recorder); err != nil {
+		return err
+	}
+
+	err := configure.applyOverrides(config)
+	recorder.record(SourceOverride)
+	return err
+}
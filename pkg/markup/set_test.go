@@ -0,0 +1,117 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSetValues(t *testing.T) {
+	certificate, err := ioutil.TempFile("/tmp", "configure.*.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(certificate.Name())
+	certificate.WriteString("-----BEGIN CERTIFICATE-----\n")
+	certificate.Close()
+
+	os.Setenv("SET1_DB_PORT", "5432")
+	defer os.Unsetenv("SET1_DB_PORT")
+
+	configure := New(&Config{ENVPrefix: "SET1", SetValues: []string{
+		"db.password=@" + certificate.Name(),
+		"db.port=6543",
+		"timeout=1m",
+		"hosts=[x, y]",
+		"contacts[1].email=admin@example.com",
+	}})
+
+	var config exampleConfig
+	if err := configure.Load(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.DB.Password != "-----BEGIN CERTIFICATE-----" {
+		t.Errorf("set values should read files, but got %v", config.DB.Password)
+	}
+
+	if config.DB.Port != 6543 || config.Timeout != time.Minute || len(config.Hosts) != 2 || config.Hosts[1] != "y" {
+		t.Errorf("set values should be parsed into their types over env, but got %+v", config)
+	}
+
+	if len(config.Contacts) != 2 || config.Contacts[1].Email != "admin@example.com" {
+		t.Errorf("set values should grow slices, but got %+v", config.Contacts)
+	}
+
+	if source := configure.GetSource("Contacts[1].Email"); source != "set:contacts[1].email" {
+		t.Errorf("source of set values should be their paths, but got %v", source)
+	}
+
+	if err := configure.Set("DB.Port", 7654); err != nil || config.DB.Port != 7654 {
+		t.Errorf("overrides should be applied over set values, but got %v, %v", config.DB.Port, err)
+	}
+
+	for _, setValue := range []string{"db.port", "=1", "db.port=port", "db.unknown=1"} {
+		if err := New(&Config{ENVPrefix: "SET1", SetValues: []string{"db.password=secret", setValue}}).Load(&exampleConfig{}); err == nil {
+			t.Errorf("invalid set value %v should return error", setValue)
+		}
+	}
+}
+
+// countingFileSystem counts reads of files of the process
+type countingFileSystem struct {
+	reads map[string]int
+}
+
+func (fs *countingFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (fs *countingFileSystem) ReadFile(name string) ([]byte, error) {
+	fs.reads[name]++
+	return ioutil.ReadFile(name)
+}
+
+func TestSetValuesReadFilesOnce(t *testing.T) {
+	password, err := ioutil.TempFile("/tmp", "configure.*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(password.Name())
+	password.WriteString("secret\n")
+	password.Close()
+
+	var (
+		fs        = &countingFileSystem{reads: map[string]int{}}
+		configure = New(&Config{ENVPrefix: "SET2", FileSystem: fs, SetValues: []string{"db.password=@" + password.Name()}})
+		config    exampleConfig
+	)
+	if err := configure.Load(&config); err != nil {
+		t.Fatalf("set values should satisfy required fields, but got %v", err)
+	}
+
+	if config.DB.Password != "secret" || fs.reads[password.Name()] != 1 {
+		t.Errorf("set values should be read once for each load, but got %v, %v reads", config.DB.Password, fs.reads[password.Name()])
+	}
+}
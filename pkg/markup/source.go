@@ -0,0 +1,116 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// ENVSource looks up env variables, Config.ENVSource replaces the env of the
+// process with it, e.g. in tests
+type ENVSource interface {
+	LookupEnv(key string) (string, bool)
+	// Environ returns env variables as `key=value`, like os.Environ
+	Environ() []string
+}
+
+// FileSystem reads configuration files, Config.FileSystem replaces the file
+// system of the process with it, e.g. in tests
+type FileSystem interface {
+	Stat(name string) (os.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+}
+
+// WritableFileSystem is a FileSystem configuration files can be saved to with
+// Save
+type WritableFileSystem interface {
+	FileSystem
+	// WriteFile replaces the content of the file name with data, creating it
+	// with perm if it doesn't exist
+	WriteFile(name string, data []byte, perm os.FileMode) error
+}
+
+type osENVSource struct{}
+
+func (osENVSource) LookupEnv(key string) (string, bool) {
+	return os.LookupEnv(key)
+}
+
+func (osENVSource) Environ() []string {
+	return os.Environ()
+}
+
+type osFileSystem struct{}
+
+func (osFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFileSystem) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+func (osFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return writeFileAtomic(name, data, perm)
+}
+
+func (config *Config) getENVSource() ENVSource {
+	if config.ENVSource != nil {
+		return config.ENVSource
+	}
+	return osENVSource{}
+}
+
+func (config *Config) getFileSystem() FileSystem {
+	if config.FileSystem != nil {
+		return config.FileSystem
+	}
+	return osFileSystem{}
+}
+
+// getenv returns the value of the env variable key, or an empty string
+func (configure *Configure) getenv(key string) string {
+	value, _ := configure.Config.getENVSource().LookupEnv(key)
+	return value
+}
+
+func (configure *Configure) environ() []string {
+	return configure.Config.getENVSource().Environ()
+}
+
+func (configure *Configure) stat(name string) (os.FileInfo, error) {
+	return configure.Config.getFileSystem().Stat(name)
+}
+
+func (configure *Configure) readFile(name string) ([]byte, error) {
+	return configure.Config.getFileSystem().ReadFile(name)
+}
+
+// writeFile writes data to the file name, if the file system can be written
+func (configure *Configure) writeFile(name string, data []byte, perm os.FileMode) error {
+	fileSystem, ok := configure.Config.getFileSystem().(WritableFileSystem)
+	if !ok {
+		return fmt.Errorf("failed to write %v, the file system is read only", name)
+	}
+	return fileSystem.WriteFile(name, data, perm)
+}
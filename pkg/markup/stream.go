@@ -0,0 +1,214 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Keys selecting documents of multi-document YAML files
+const (
+	DocumentEnvironmentKey = "environment"
+	DocumentProfileKey     = "profile"
+)
+
+var (
+	documentStartRegexp = regexp.MustCompile(`^---(\s|$)`)
+	documentEndRegexp   = regexp.MustCompile(`^\.\.\.(\s|$)`)
+)
+
+// documentsKey holds earlier documents of a stream while decoding a document,
+// so that their anchors can be referenced
+const documentsKey = "__configure_documents__"
+
+// yamlDocument is a document of a YAML stream
+type yamlDocument struct {
+	data []byte
+	// line of the stream where data starts
+	line int
+}
+
+// splitYAMLDocuments splits a YAML stream into its documents, leaving out
+// empty ones
+func splitYAMLDocuments(data []byte) []yamlDocument {
+	var (
+		documents []yamlDocument
+		current   []string
+		start     = 1
+	)
+
+	flush := func(next int) {
+		if document := strings.Join(current, "\n"); strings.TrimSpace(stripYAMLComments(document)) != "" {
+			documents = append(documents, yamlDocument{data: []byte(document + "\n"), line: start})
+		}
+		current, start = nil, next
+	}
+
+	for idx, line := range strings.Split(string(data), "\n") {
+		switch {
+		case documentStartRegexp.MatchString(line):
+			// content may follow the document start marker, like `--- {}`
+			if rest := strings.TrimSpace(line[3:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				flush(idx + 1)
+				current = append(current, rest)
+			} else {
+				flush(idx + 2)
+			}
+		case documentEndRegexp.MatchString(line):
+			flush(idx + 2)
+		default:
+			current = append(current, line)
+		}
+	}
+	flush(0)
+	return documents
+}
+
+func stripYAMLComments(document string) string {
+	var lines []string
+	for _, line := range strings.Split(document, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// selectDocuments merges the documents of a multi-document YAML stream in
+// order into a single document. Documents with an `environment` or `profile`
+// key are merged only if they match the current environment or one of the
+// current profiles, anchors can be referenced by later documents. These keys
+// are removed, unless they are keys of fields of config
+func (configure *Configure) selectDocuments(config interface{}, file string, data []byte) ([]byte, error) {
+	if format := getFileFormat(file); format != FormatYAML && (format != "" || detectFormat(data) != FormatYAML) {
+		return data, nil
+	}
+
+	documents := splitYAMLDocuments(data)
+	if len(documents) <= 1 {
+		return data, nil
+	}
+
+	merged := map[string]interface{}{}
+	for idx, document := range documents {
+		doc, err := decodeDocument(document.data, FormatYAML)
+		if err != nil && strings.Contains(err.Error(), "unknown anchor") {
+			doc, err = decodeStreamDocument(documents[:idx+1])
+		}
+
+		if err != nil {
+			// report positions in the stream, rather than in the document
+			decodeErr := newDecodeError(file, document.data, FormatYAML, fmt.Errorf("document %v: %w", idx+1, err)).(*DecodeError)
+			if decodeErr.Line > 0 {
+				decodeErr.Line += document.line - 1
+				decodeErr.Excerpt = getExcerpt(data, decodeErr.Line, decodeErr.Column)
+			}
+			return nil, decodeErr
+		}
+
+		if !configure.matchDocument(doc) {
+			continue
+		}
+		for _, key := range []string{DocumentEnvironmentKey, DocumentProfileKey} {
+			if config == nil || documentFieldType(reflect.TypeOf(config), key, FormatYAML) == nil {
+				delete(doc, key)
+			}
+		}
+		mergeDocument(merged, doc)
+	}
+
+	return yaml.Marshal(merged)
+}
+
+// decodeStreamDocument decodes the last of documents, with the earlier ones
+// in scope, so that it can reference their anchors
+func decodeStreamDocument(documents []yamlDocument) (map[string]interface{}, error) {
+	var buffer bytes.Buffer
+	if len(documents) > 1 {
+		fmt.Fprintf(&buffer, "%v:\n", documentsKey)
+		for _, document := range documents[:len(documents)-1] {
+			buffer.WriteString("  -\n")
+			for _, line := range strings.Split(strings.TrimRight(string(document.data), "\n"), "\n") {
+				buffer.WriteString("    " + line + "\n")
+			}
+		}
+	}
+	buffer.Write(documents[len(documents)-1].data)
+
+	doc, err := decodeDocument(buffer.Bytes(), FormatYAML)
+	if err != nil {
+		return nil, err
+	}
+	delete(doc, documentsKey)
+	return doc, nil
+}
+
+// matchDocument reports whether the `environment` and `profile` keys of doc
+// match the current environment and profiles, when they are set
+func (configure *Configure) matchDocument(doc map[string]interface{}) bool {
+	if value, ok := doc[DocumentEnvironmentKey]; ok && !matchDocumentKey(value, []string{configure.GetEnvironment()}) {
+		return false
+	}
+	if value, ok := doc[DocumentProfileKey]; ok && !matchDocumentKey(value, configure.GetProfiles()) {
+		return false
+	}
+	return true
+}
+
+// matchDocumentKey reports whether value, a string or a list of strings,
+// holds one of names
+func matchDocumentKey(value interface{}, names []string) bool {
+	var values []interface{}
+	if list, ok := value.([]interface{}); ok {
+		values = list
+	} else {
+		values = []interface{}{value}
+	}
+
+	for _, value := range values {
+		for _, name := range names {
+			if fmt.Sprint(value) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mergeDocument deep merges src into dst, values of src replace values of
+// dst, except mappings that are merged
+func mergeDocument(dst, src map[string]interface{}) {
+	for key, value := range src {
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		srcMap, srcIsMap := value.(map[string]interface{})
+		if dstIsMap && srcIsMap {
+			mergeDocument(dstMap, srcMap)
+		} else {
+			dst[key] = value
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMultiDocumentYAML(t *testing.T) {
+	type dbConfig struct {
+		Name string
+		Port int
+		User string
+	}
+	type streamConfig struct {
+		APPName string
+		Debug   bool
+		DB      dbConfig
+		Replica dbConfig
+	}
+
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`# shared by every environment
+appname: app
+db: &db
+  name: dev
+  port: 3306
+  user: root
+---
+environment: production
+db:
+  name: prod
+replica:
+  <<: *db
+  name: replica
+---
+environment: [test, development]
+db:
+  name: test
+--- # debug profile
+profile: debug
+debug: true
+`)
+	file.Close()
+
+	var config streamConfig
+	if err := New(&Config{ENVPrefix: "STREAM1", Environment: "production", Profiles: []string{"debug"}}).Load(&config, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := streamConfig{APPName: "app", Debug: true, DB: dbConfig{Name: "prod", Port: 3306, User: "root"}, Replica: dbConfig{Name: "replica", Port: 3306, User: "root"}}
+	if config != expected {
+		t.Errorf("documents of production and debug should be merged, but got %+v", config)
+	}
+
+	config = streamConfig{}
+	if err := New(&Config{ENVPrefix: "STREAM1", Environment: "development"}).Load(&config, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected = streamConfig{APPName: "app", DB: dbConfig{Name: "test", Port: 3306, User: "root"}}
+	if config != expected {
+		t.Errorf("documents of development should be merged, but got %+v", config)
+	}
+
+	tree, err := New(&Config{ENVPrefix: "STREAM1", Environment: "production"}).LoadTree(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := tree.GetString("replica.name"); name != "replica" || tree.IsSet("environment") {
+		t.Errorf("tree should load merged documents, but got %v", name)
+	}
+}
+
+func TestMultiDocumentYAMLError(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("appname: app\n---\nenvironment: production\nappname: a: b\n")
+	file.Close()
+
+	var config struct{ APPName string }
+	err = New(&Config{ENVPrefix: "STREAM2"}).Load(&config, file.Name())
+
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Line != 4 || !strings.Contains(decodeErr.Error(), "document 2") {
+		t.Errorf("error should be reported at line 4 of document 2, but got %v", err)
+	}
+}
+
+func TestSingleDocumentYAMLEnvironmentField(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("environment: production\nname: svc\n")
+	file.Close()
+
+	type environmentConfig struct {
+		Environment string
+		Name        string
+	}
+
+	for _, environment := range []string{"development", "production"} {
+		var config environmentConfig
+		if err := New(&Config{ENVPrefix: "STREAM3", Environment: environment}).Load(&config, file.Name()); err != nil || (config != environmentConfig{Environment: "production", Name: "svc"}) {
+			t.Errorf("single documents should be loaded as they are in %v, but got %+v, %v", environment, config, err)
+		}
+	}
+}
+
+func TestMultiDocumentYAMLEnvironmentField(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("name: svc\n---\nenvironment: production\nname: prod\n")
+	file.Close()
+
+	var config struct {
+		Environment string
+		Name        string
+	}
+	if err := New(&Config{ENVPrefix: "STREAM4", Environment: "production"}).Load(&config, file.Name()); err != nil || config.Environment != "production" || config.Name != "prod" {
+		t.Errorf("environment keys of fields should be kept, but got %+v, %v", config, err)
+	}
+}
@@ -0,0 +1,180 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// controlENVNames are env variables configuring configure itself, they are
+// never reported as unmatched
+var controlENVNames = map[string]bool{
+	"CONFIGURE_ENV":            true,
+	"CONFIGURE_ENV_PREFIX":     true,
+	"CONFIGURE_DEBUG_MODE":     true,
+	"CONFIGURE_VERBOSE_MODE":   true,
+	"CONFIGURE_SILENT_MODE":    true,
+	"CONFIGURE_PROFILES":       true,
+	"CONFIGURE_SECRET_KEYS":    true,
+	"CONFIGURE_SECRET_KEYFILE": true,
+}
+
+// UnmatchedENVError is returned by Load when StrictENV is set and there are
+// env variables with the env prefix that don't match any field
+type UnmatchedENVError struct {
+	Names []string
+	// Suggestions holds the closest valid names of unmatched env variables
+	Suggestions map[string][]string
+}
+
+func (e *UnmatchedENVError) Error() string {
+	var names []string
+	for _, name := range e.Names {
+		if suggestions := e.Suggestions[name]; len(suggestions) > 0 {
+			name = fmt.Sprintf("%v (did you mean %v?)", name, strings.Join(suggestions, " or "))
+		}
+		names = append(names, name)
+	}
+	return fmt.Sprintf("There are env variables that do not match any field in the given struct: %v", strings.Join(names, ", "))
+}
+
+// recordENVNames records env names tried by processTags in strict env mode
+func (configure *Configure) recordENVNames(names []string) {
+	configure.mutex.Lock()
+	defer configure.mutex.Unlock()
+
+	if configure.triedENVNames != nil {
+		for _, name := range names {
+			configure.triedENVNames[name] = true
+		}
+	}
+}
+
+// checkUnmatchedENV returns an UnmatchedENVError if env variables with
+// prefix haven't been tried by processTags
+func (configure *Configure) checkUnmatchedENV(prefix string) error {
+	configure.mutex.Lock()
+	tried := configure.triedENVNames
+	configure.triedENVNames = nil
+	configure.mutex.Unlock()
+
+	if prefix == "-" || tried == nil {
+		return nil
+	}
+
+	var unmatched []string
+	for _, env := range configure.environ() {
+		name := strings.SplitN(env, "=", 2)[0]
+		if !strings.HasPrefix(strings.ToUpper(name), strings.ToUpper(prefix)+"_") || controlENVNames[name] || tried[name] {
+			continue
+		}
+		unmatched = append(unmatched, name)
+	}
+
+	if len(unmatched) == 0 {
+		return nil
+	}
+	sort.Strings(unmatched)
+
+	err := &UnmatchedENVError{Names: unmatched, Suggestions: map[string][]string{}}
+	for _, name := range unmatched {
+		if suggestions := suggestENVNames(name, tried); len(suggestions) > 0 {
+			err.Suggestions[name] = suggestions
+		}
+	}
+	return err
+}
+
+// suggestENVNames returns up to 3 names of candidates closest to name by edit
+// distance, ignoring case, closer first
+func suggestENVNames(name string, candidates map[string]bool) []string {
+	type suggestion struct {
+		name     string
+		distance int
+	}
+
+	var (
+		suggestions []suggestion
+		seen        = map[string]bool{}
+		maxDistance = len(name)/4 + 1
+	)
+	for candidate := range candidates {
+		// suggest names in the case of name, e.g. upper case
+		if name == strings.ToUpper(name) {
+			candidate = strings.ToUpper(candidate)
+		}
+		if seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+
+		if distance := levenshtein(strings.ToUpper(name), strings.ToUpper(candidate)); distance <= maxDistance {
+			suggestions = append(suggestions, suggestion{name: candidate, distance: distance})
+		}
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].distance != suggestions[j].distance {
+			return suggestions[i].distance < suggestions[j].distance
+		}
+		return suggestions[i].name < suggestions[j].name
+	})
+
+	var results []string
+	for i := 0; i < len(suggestions) && i < 3; i++ {
+		results = append(results, suggestions[i].name)
+	}
+	return results
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+	return result
+}
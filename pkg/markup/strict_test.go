@@ -0,0 +1,84 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStrictENV(t *testing.T) {
+	os.Setenv("STRICT1_DB_PASSWORD", "secret")
+	os.Setenv("STRICT1_DB_PASWORD", "typo")
+	os.Setenv("STRICT1_CONTACTS_0_EMAIL", "admin@example.com")
+	os.Setenv("STRICT1_UNKNOWN", "unknown")
+	defer os.Unsetenv("STRICT1_DB_PASSWORD")
+	defer os.Unsetenv("STRICT1_DB_PASWORD")
+	defer os.Unsetenv("STRICT1_CONTACTS_0_EMAIL")
+	defer os.Unsetenv("STRICT1_UNKNOWN")
+
+	var config exampleConfig
+	if err := New(&Config{ENVPrefix: "STRICT1"}).Load(&config); err != nil {
+		t.Errorf("No error should happen when StrictENV is false, but got %v", err)
+	}
+
+	err := New(&Config{ENVPrefix: "STRICT1", StrictENV: true}).Load(&exampleConfig{})
+
+	var unmatchedErr *UnmatchedENVError
+	if !errors.As(err, &unmatchedErr) {
+		t.Fatalf("UnmatchedENVError should be returned, but got %v", err)
+	}
+
+	if !reflect.DeepEqual(unmatchedErr.Names, []string{"STRICT1_DB_PASWORD", "STRICT1_UNKNOWN"}) {
+		t.Errorf("unmatched env variables should be reported, but got %v", unmatchedErr.Names)
+	}
+
+	if suggestions := unmatchedErr.Suggestions["STRICT1_DB_PASWORD"]; len(suggestions) == 0 || suggestions[0] != "STRICT1_DB_PASSWORD" {
+		t.Errorf("closest env variable should be suggested, but got %v", suggestions)
+	}
+
+	if _, ok := unmatchedErr.Suggestions["STRICT1_UNKNOWN"]; ok {
+		t.Errorf("no env variable should be suggested for unrelated names, but got %v", unmatchedErr.Suggestions["STRICT1_UNKNOWN"])
+	}
+
+	if !strings.Contains(err.Error(), "STRICT1_DB_PASWORD (did you mean STRICT1_DB_PASSWORD") {
+		t.Errorf("error should contain suggestions, but got %v", err)
+	}
+
+	os.Unsetenv("STRICT1_DB_PASWORD")
+	os.Unsetenv("STRICT1_UNKNOWN")
+	if err := New(&Config{ENVPrefix: "STRICT1", StrictENV: true}).Load(&exampleConfig{}); err != nil {
+		t.Errorf("No error should happen when every env variable matches a field, but got %v", err)
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	for _, c := range []struct {
+		a, b     string
+		distance int
+	}{{"", "", 0}, {"abc", "", 3}, {"PASWORD", "PASSWORD", 1}, {"kitten", "sitting", 3}} {
+		if distance := levenshtein(c.a, c.b); distance != c.distance {
+			t.Errorf("distance between %v and %v should be %v, but got %v", c.a, c.b, c.distance, distance)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TemplateError is returned when a configuration file can't be rendered as
+// a template
+type TemplateError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *TemplateError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("failed to render %v:%v: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("failed to render %v: %v", e.File, e.Err)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// TemplateData is the data configuration files are rendered with
+type TemplateData struct {
+	Environment string
+	Profiles    []string
+}
+
+// templateLineRegexp matches the location of template errors, like
+// `template: config.yml:3:10: executing ...`
+var templateLineRegexp = regexp.MustCompile(`^template: .*?:(\d+)(?::\d+)?: `)
+
+// getTemplateFuncs returns the functions of configuration templates
+func (configure *Configure) getTemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"env": configure.getenv,
+		"file": func(file string) (string, error) {
+			content, err := configure.readFile(file)
+			return string(content), err
+		},
+		// default returns value, or defaultValue if value is empty, e.g.
+		// `{{ env "PORT" | default "8080" }}`
+		"default": func(defaultValue interface{}, value ...interface{}) interface{} {
+			if len(value) == 0 || value[0] == nil || reflect.ValueOf(value[0]).IsZero() {
+				return defaultValue
+			}
+			return value[0]
+		},
+		// required returns value, or fails with message if value is empty, e.g.
+		// `{{ env "DB_PASSWORD" | required "DB_PASSWORD is required" }}`
+		"required": func(message string, value interface{}) (interface{}, error) {
+			if value == nil || reflect.ValueOf(value).IsZero() {
+				return nil, errors.New(message)
+			}
+			return value, nil
+		},
+		"b64dec": func(value string) (string, error) {
+			content, err := base64.StdEncoding.DecodeString(value)
+			return string(content), err
+		},
+		"toYaml": func(value interface{}) (string, error) {
+			content, err := yaml.Marshal(value)
+			return strings.TrimSuffix(string(content), "\n"), err
+		},
+	}
+}
+
+// GetProfiles returns the active profiles, from Config.Profiles or the
+// comma separated env CONFIGURE_PROFILES
+func (configure *Configure) GetProfiles() []string {
+	if len(configure.Profiles) > 0 {
+		return configure.Profiles
+	}
+
+	var profiles []string
+	for _, profile := range strings.Split(configure.getenv("CONFIGURE_PROFILES"), ",") {
+		if profile = strings.TrimSpace(profile); profile != "" {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles
+}
+
+// renderTemplate renders data of file with text/template if RenderTemplates
+// is enabled
+func (configure *Configure) renderTemplate(file string, data []byte) ([]byte, error) {
+	if !configure.RenderTemplates {
+		return data, nil
+	}
+
+	tmpl, err := template.New(file).Funcs(configure.getTemplateFuncs()).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, newTemplateError(file, err)
+	}
+
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, TemplateData{Environment: configure.GetEnvironment(), Profiles: configure.GetProfiles()}); err != nil {
+		return nil, newTemplateError(file, err)
+	}
+	return buffer.Bytes(), nil
+}
+
+func newTemplateError(file string, err error) *TemplateError {
+	templateError := &TemplateError{File: file, Err: err}
+	if matches := templateLineRegexp.FindStringSubmatch(err.Error()); matches != nil {
+		templateError.Line, _ = strconv.Atoi(matches[1])
+		templateError.Err = errors.New(strings.TrimPrefix(err.Error(), matches[0]))
+	}
+	return templateError
+}
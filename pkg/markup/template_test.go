@@ -0,0 +1,68 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplates(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`appname: {{ .Environment }}-{{ index .Profiles 0 }}
+hosts:
+{{ .Profiles | toYaml }}
+db:
+  name: {{ env "TEMPLATE1_NAME" | default "configure" }}
+  password: {{ "c2VjcmV0" | b64dec }}
+  port: {{ env "TEMPLATE1_PORT" | required "port is required" }}
+`)
+	file.Close()
+
+	os.Setenv("TEMPLATE1_PORT", "5432")
+	defer os.Unsetenv("TEMPLATE1_PORT")
+
+	var config exampleConfig
+	configure := New(&Config{ENVPrefix: "TEMPLATE1", Environment: "production", Profiles: []string{"blue", "green"}, RenderTemplates: true})
+	if err := configure.Load(&config, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.APPName != "production-blue" || config.DB.Name != "configure" || config.DB.Password != "secret" || config.DB.Port != 5432 || !reflect.DeepEqual(config.Hosts, []string{"blue", "green"}) {
+		t.Errorf("configuration should be rendered, but got %+v", config)
+	}
+
+	os.Unsetenv("TEMPLATE1_PORT")
+	err = configure.Load(&exampleConfig{}, file.Name())
+
+	var templateError *TemplateError
+	if !errors.As(err, &templateError) || templateError.File != file.Name() || templateError.Line != 7 || !strings.Contains(err.Error(), "port is required") {
+		t.Errorf("template errors should be reported with file and line, but got %#v", err)
+	}
+}
@@ -0,0 +1,685 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Tree is a configuration loaded without a Go struct, its values are read by
+// key paths like `db.host` or `contacts[0].email`, matched case insensitively.
+// Values are read from overrides set with Set, then env variables, e.g.
+// `CONFIGURE_DB_HOST` for `db.host`, then configuration files
+type Tree struct {
+	root *treeRoot
+	path []string
+}
+
+type treeRoot struct {
+	configure *Configure
+	files     []string
+
+	mutex    sync.RWMutex
+	data     map[string]interface{}
+	modTimes map[string]time.Time
+}
+
+// LoadTree loads configurations from files into a Tree, with the same files
+// lookup, migrations and decryption as Load. Files are reloaded like Load in
+// auto reload mode, and subscribers of OnChange are notified with the changed
+// key paths
+func (configure *Configure) LoadTree(files ...string) (*Tree, error) {
+	if err := configure.loadOverrides(); err != nil {
+		return nil, err
+	}
+
+	root := &treeRoot{configure: configure, files: files}
+	if _, err := root.load(false); err != nil {
+		return nil, err
+	}
+
+	if configure.Config.AutoReload {
+		go func() {
+			timer := time.NewTimer(configure.Config.AutoReloadInterval)
+			for range timer.C {
+				if _, err := root.load(true); err != nil {
+					configure.log(LevelError, "Failed to reload configuration", Fields{"files": files, "error": err})
+				}
+				timer.Reset(configure.Config.AutoReloadInterval)
+			}
+		}()
+	}
+	return &Tree{root: root}, nil
+}
+
+// LoadTree loads configurations from files into a Tree, see Configure.LoadTree
+func LoadTree(files ...string) (*Tree, error) {
+	return New(nil).LoadTree(files...)
+}
+
+// Reload reads the files of tree again, whether they have been changed or not
+func (tree *Tree) Reload() error {
+	_, err := tree.root.load(false)
+	return err
+}
+
+// load reads and merges files, in watch mode only if they have been changed
+func (root *treeRoot) load(watchMode bool) (bool, error) {
+	configure := root.configure
+	configFiles, modTimes := configure.getConfigurationFiles(watchMode, root.files...)
+
+	if watchMode {
+		root.mutex.RLock()
+		changed := len(modTimes) != len(root.modTimes)
+		for file, modTime := range modTimes {
+			if previous, ok := root.modTimes[file]; !ok || modTime.After(previous) {
+				changed = true
+			}
+		}
+		root.mutex.RUnlock()
+
+		if !changed {
+			return false, nil
+		}
+	}
+
+	data := map[string]interface{}{}
+	for _, file := range configFiles {
+		content, err := configure.readFile(file)
+		if err != nil {
+			return false, err
+		}
+
+		if content, err = configure.renderTemplate(file, content); err != nil {
+			return false, err
+		}
+
+		if content, err = configure.selectDocuments(nil, file, content); err != nil {
+			return false, err
+		}
+
+		format := getFileFormat(file)
+		if format == "" {
+			format = detectFormat(content)
+		}
+
+		doc, err := decodeDocument(content, format)
+		if err != nil {
+			return false, newDecodeError(file, content, format, err)
+		}
+
+		if _, err := configure.migrateDocument(file, nil, doc, format); err != nil {
+			return false, err
+		}
+		if err := configure.decryptDocument(file, nil, doc, format, nil); err != nil {
+			return false, err
+		}
+		mergeTree(data, normalizeTree(doc).(map[string]interface{}))
+	}
+
+	root.mutex.Lock()
+	old := root.data
+	root.data, root.modTimes = data, modTimes
+	root.mutex.Unlock()
+
+	if old != nil {
+		if paths := diffTrees("", old, data, nil); len(paths) > 0 {
+			configure.notify(ChangeEvent{Old: old, New: data, Changed: paths})
+		}
+	}
+	return true, nil
+}
+
+// normalizeTree converts lists of tables decoded from toml files into lists
+// of values, and numbers decoded from json files into int64 or float64
+func normalizeTree(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = normalizeTree(value)
+		}
+	case []map[string]interface{}:
+		list := make([]interface{}, len(v))
+		for i, value := range v {
+			list[i] = normalizeTree(value)
+		}
+		return list
+	case []interface{}:
+		for i, value := range v {
+			v[i] = normalizeTree(value)
+		}
+	}
+	return value
+}
+
+// mergeTree merges src into dst, keys are matched case insensitively, and
+// values other than maps are replaced
+func mergeTree(dst, src map[string]interface{}) {
+	for key, value := range src {
+		existing, ok := findTreeKey(dst, key)
+		if !ok {
+			dst[key] = value
+			continue
+		}
+
+		dstMap, dstIsMap := dst[existing].(map[string]interface{})
+		srcMap, srcIsMap := value.(map[string]interface{})
+		if dstIsMap && srcIsMap {
+			mergeTree(dstMap, srcMap)
+		} else {
+			dst[existing] = value
+		}
+	}
+}
+
+// findTreeKey returns the key of m matching key case insensitively
+func findTreeKey(m map[string]interface{}, key string) (string, bool) {
+	if _, ok := m[key]; ok {
+		return key, true
+	}
+	for k := range m {
+		if strings.EqualFold(k, key) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// diffTrees appends the key paths of values that differ between oldValue and
+// newValue to changed
+func diffTrees(path string, oldValue, newValue interface{}, changed []string) []string {
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if !oldIsMap || !newIsMap {
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changed = append(changed, path)
+		}
+		return changed
+	}
+
+	var keys []string
+	for key := range oldMap {
+		keys = append(keys, key)
+	}
+	for key := range newMap {
+		if _, ok := oldMap[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		changed = diffTrees(joinPath(path, key), oldMap[key], newMap[key], changed)
+	}
+	return changed
+}
+
+// splitTreePath splits a key path like `db.hosts[0]` into its segments
+func splitTreePath(path string) ([]string, error) {
+	var segments []string
+	for rest := path; rest != ""; {
+		matches := pathSegmentRegexp.FindStringSubmatch(rest)
+		if matches == nil {
+			return nil, fmt.Errorf("invalid path %v", path)
+		}
+		rest = rest[len(matches[0]):]
+
+		if matches[2] != "" {
+			segments = append(segments, matches[2])
+		} else {
+			segments = append(segments, matches[1])
+		}
+	}
+	return segments, nil
+}
+
+// joinTreePath joins segments into a key path, e.g. `db.hosts[0]`
+func joinTreePath(segments []string) string {
+	var path string
+	for _, segment := range segments {
+		if _, err := strconv.Atoi(segment); err == nil {
+			path = fmt.Sprintf("%v[%v]", path, segment)
+		} else {
+			path = joinPath(path, segment)
+		}
+	}
+	return path
+}
+
+// Sub returns the subtree at path, it reads the values of tree, so that it
+// follows its reloads
+func (tree *Tree) Sub(path string) *Tree {
+	segments, _ := splitTreePath(path)
+	return &Tree{root: tree.root, path: append(append([]string{}, tree.path...), segments...)}
+}
+
+// Get returns the value at path, or nil if it is not set
+func (tree *Tree) Get(path string) interface{} {
+	value, _ := tree.lookup(path)
+	return value
+}
+
+// IsSet reports whether the value at path is set
+func (tree *Tree) IsSet(path string) bool {
+	_, ok := tree.lookup(path)
+	return ok
+}
+
+// lookup returns the value at path from overrides, env variables or files
+func (tree *Tree) lookup(path string) (interface{}, bool) {
+	segments, err := splitTreePath(path)
+	if err != nil {
+		return nil, false
+	}
+	segments = append(append([]string{}, tree.path...), segments...)
+
+	if value, ok := tree.root.lookupOverride(segments); ok {
+		return value, true
+	}
+
+	if value, ok := tree.root.lookupSetValue(segments); ok {
+		return value, true
+	}
+
+	if value, ok := tree.root.lookupENV(segments); ok {
+		return value, true
+	}
+
+	tree.root.mutex.RLock()
+	defer tree.root.mutex.RUnlock()
+
+	var value interface{} = tree.root.data
+	for _, segment := range segments {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			key, ok := findTreeKey(v, segment)
+			if !ok {
+				return nil, false
+			}
+			value = v[key]
+		case []interface{}:
+			idx, err := strconv.Atoi(segment)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil, false
+			}
+			value = v[idx]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// matchSegments reports whether the segments of two key paths are equal,
+// case insensitively
+func matchSegments(segments, other []string) bool {
+	if len(segments) != len(other) {
+		return false
+	}
+	for i, segment := range segments {
+		if !strings.EqualFold(segment, other[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupOverride returns the value set with Set at segments
+func (root *treeRoot) lookupOverride(segments []string) (interface{}, bool) {
+	if len(segments) == 0 {
+		return nil, false
+	}
+
+	configure := root.configure
+	configure.mutex.Lock()
+	defer configure.mutex.Unlock()
+
+	for path, override := range configure.overrides {
+		if override.isExpired(time.Now()) {
+			continue
+		}
+
+		if overrideSegments, err := splitTreePath(path); err == nil && matchSegments(overrideSegments, segments) {
+			return override.Value, true
+		}
+	}
+	return nil, false
+}
+
+// lookupSetValue returns the last value of Config.SetValues assigned to
+// segments
+func (root *treeRoot) lookupSetValue(segments []string) (interface{}, bool) {
+	setValues, err := root.configure.parseSetValues(root.configure.Config.SetValues)
+	if err != nil {
+		return nil, false
+	}
+
+	for i := len(setValues) - 1; i >= 0; i-- {
+		if setSegments, err := splitTreePath(setValues[i].path); err == nil && matchSegments(setSegments, segments) {
+			return setValues[i].value, true
+		}
+	}
+	return nil, false
+}
+
+// lookupENV returns the value of the env variable of segments, e.g.
+// `CONFIGURE_DB_HOST` for `db.host`
+func (root *treeRoot) lookupENV(segments []string) (interface{}, bool) {
+	if len(segments) == 0 {
+		return nil, false
+	}
+
+	prefixes := root.configure.getTreePrefixes(nil, segments[:len(segments)-1])
+	for _, env := range root.configure.getENVNames(prefixes, &reflect.StructField{Name: segments[len(segments)-1]}) {
+		if value := root.configure.getenv(env); value != "" {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// GetString returns the value at path as a string
+func (tree *Tree) GetString(path string) string {
+	switch value := tree.Get(path).(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// GetInt returns the value at path as an int, or 0 if it is not a number
+func (tree *Tree) GetInt(path string) int {
+	switch value := tree.Get(path).(type) {
+	case string:
+		i, _ := strconv.Atoi(strings.TrimSpace(value))
+		return i
+	default:
+		number := reflect.ValueOf(value)
+		switch number.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return int(number.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int(number.Uint())
+		case reflect.Float32, reflect.Float64:
+			return int(number.Float())
+		}
+	}
+	return 0
+}
+
+// GetFloat64 returns the value at path as a float64, or 0 if it is not a number
+func (tree *Tree) GetFloat64(path string) float64 {
+	switch value := tree.Get(path).(type) {
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return f
+	case float64:
+		return value
+	case float32:
+		return float64(value)
+	}
+
+	if tree.IsSet(path) {
+		return float64(tree.GetInt(path))
+	}
+	return 0
+}
+
+// GetBool returns the value at path as a bool, strings are parsed like env
+// variables
+func (tree *Tree) GetBool(path string) bool {
+	switch value := tree.Get(path).(type) {
+	case bool:
+		return value
+	case string:
+		switch strings.ToLower(value) {
+		case "", "0", "f", "false":
+			return false
+		}
+		return true
+	case nil:
+		return false
+	}
+	return tree.GetFloat64(path) != 0
+}
+
+// GetDuration returns the value at path as a time.Duration, strings are
+// parsed like `5s` and numbers are nanoseconds
+func (tree *Tree) GetDuration(path string) time.Duration {
+	if value, ok := tree.Get(path).(string); ok {
+		duration, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			nanoseconds, _ := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			return time.Duration(nanoseconds)
+		}
+		return duration
+	}
+	return time.Duration(tree.GetInt(path))
+}
+
+// GetStringSlice returns the value at path as a slice of strings, strings
+// are parsed like env variables, e.g. `[a, b]`, or split by commas
+func (tree *Tree) GetStringSlice(path string) []string {
+	var results []string
+	switch value := tree.Get(path).(type) {
+	case []interface{}:
+		for _, elem := range value {
+			results = append(results, fmt.Sprint(elem))
+		}
+	case []string:
+		results = value
+	case string:
+		if err := yaml.Unmarshal([]byte(value), &results); err != nil {
+			results = nil
+			for _, elem := range strings.Split(value, ",") {
+				results = append(results, strings.TrimSpace(elem))
+			}
+		}
+	}
+	return results
+}
+
+// Decode decodes the tree into config, after setting its default values.
+// Keys are matched case insensitively with field names or their keys in
+// files, and env variables override values with the names struct loading
+// uses, e.g. `CONFIGURE_DB_HOST` for the field Host of `Sub("db")`
+func (tree *Tree) Decode(config interface{}) error {
+	configValue := reflect.ValueOf(config)
+	if configValue.Kind() != reflect.Ptr || configValue.Elem().Kind() != reflect.Struct {
+		return errors.New("config should be a pointer to struct")
+	}
+
+	configure := tree.root.configure
+	if err := configure.processDefaults(config); err != nil {
+		return err
+	}
+
+	tree.root.mutex.RLock()
+	var value interface{} = tree.root.data
+	for _, segment := range tree.path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			key, _ := findTreeKey(v, segment)
+			value = v[key]
+		case []interface{}:
+			if idx, err := strconv.Atoi(segment); err == nil && idx >= 0 && idx < len(v) {
+				value = v[idx]
+			} else {
+				value = nil
+			}
+		default:
+			value = nil
+		}
+	}
+	data, err := yaml.Marshal(matchTreeKeys(configValue.Elem().Type(), value))
+	tree.root.mutex.RUnlock()
+
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return err
+	}
+
+	if err := configure.processTags(config, configure.getTreePrefixes(config, tree.path)...); err != nil {
+		return err
+	}
+	return configure.applyTreeOverrides(config, tree.path)
+}
+
+// getTreePrefixes returns the prefixes of env variables of the values of the
+// subtree at path, named the same way as the fields of nested structs
+func (configure *Configure) getTreePrefixes(config interface{}, path []string) []string {
+	var prefixes []string
+	if prefix := configure.getENVPrefix(config); prefix != "-" {
+		prefixes = append(prefixes, prefix)
+	}
+
+	for _, segment := range path {
+		prefixes = configure.getPrefixForStruct(prefixes, &reflect.StructField{Name: segment})
+	}
+	return prefixes
+}
+
+// applyTreeOverrides assigns Config.SetValues, then overrides of the subtree
+// at path to config
+func (configure *Configure) applyTreeOverrides(config interface{}, path []string) error {
+	type assignment struct {
+		path  string
+		value interface{}
+	}
+
+	var assignments, overrides []assignment
+	if setValues, err := configure.parseSetValues(configure.Config.SetValues); err == nil {
+		for _, setValue := range setValues {
+			assignments = append(assignments, assignment{path: setValue.path, value: setValue.value})
+		}
+	}
+
+	configure.mutex.Lock()
+	for overridePath, override := range configure.overrides {
+		if !override.isExpired(time.Now()) {
+			overrides = append(overrides, assignment{path: overridePath, value: override.Value})
+		}
+	}
+	configure.mutex.Unlock()
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].path < overrides[j].path })
+
+	for _, assignment := range append(assignments, overrides...) {
+		segments, err := splitTreePath(assignment.path)
+		if err != nil || len(segments) <= len(path) || !matchSegments(segments[:len(path)], path) {
+			continue
+		}
+
+		if _, _, err := setPath(reflect.ValueOf(config).Elem(), joinTreePath(segments[len(path):]), assignment.value, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchTreeKeys renames the keys of value matching fields of t to their yaml
+// keys, so that values are decoded whatever the format of their files
+func matchTreeKeys(t reflect.Type, value interface{}) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Struct:
+			results := map[string]interface{}{}
+			for key, elem := range v {
+				if fieldStruct, ok := findStructField(t, key); ok {
+					yamlKey, _ := documentKey(&fieldStruct, FormatYAML)
+					results[yamlKey] = matchTreeKeys(fieldStruct.Type, elem)
+				} else {
+					results[key] = elem
+				}
+			}
+			return results
+		case reflect.Map:
+			results := map[string]interface{}{}
+			for key, elem := range v {
+				results[key] = matchTreeKeys(t.Elem(), elem)
+			}
+			return results
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			results := make([]interface{}, len(v))
+			for i, elem := range v {
+				results[i] = matchTreeKeys(t.Elem(), elem)
+			}
+			return results
+		}
+	}
+	return value
+}
+
+// findStructField returns the field of t named key, or with key as key in
+// files, case insensitively. Fields of embedded structs inlined in yaml are
+// found as well
+func findStructField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		fieldStruct := t.Field(i)
+		if fieldStruct.PkgPath != "" {
+			continue
+		}
+
+		if _, inline := documentKey(&fieldStruct, FormatYAML); inline {
+			if field, ok := findStructField(fieldStruct.Type, key); ok {
+				return field, true
+			}
+			continue
+		}
+
+		if strings.EqualFold(fieldStruct.Name, key) {
+			return fieldStruct, true
+		}
+		for _, format := range []string{FormatYAML, FormatTOML, FormatJSON} {
+			if documentKey, inline := documentKey(&fieldStruct, format); !inline && strings.EqualFold(documentKey, key) {
+				return fieldStruct, true
+			}
+		}
+	}
+	return reflect.StructField{}, false
+}
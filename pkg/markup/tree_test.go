@@ -0,0 +1,161 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadTree(t *testing.T) {
+	yamlFile, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(yamlFile.Name())
+	yamlFile.WriteString("appname: tree\ntimeout: 10s\nhosts: [a, b]\ndb:\n  name: tree\n  port: 3306\ncontacts:\n- name: admin\n  email: admin@example.com\n")
+	yamlFile.Close()
+
+	jsonFile, err := ioutil.TempFile("/tmp", "configure.*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(jsonFile.Name())
+	jsonFile.WriteString(`{"DB": {"Name": "override", "Password": "secret"}}`)
+	jsonFile.Close()
+
+	os.Setenv("TREE1_DB_PORT", "5432")
+	defer os.Unsetenv("TREE1_DB_PORT")
+
+	tree, err := New(&Config{ENVPrefix: "TREE1"}).LoadTree(jsonFile.Name(), yamlFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := tree.GetString("AppName"); got != "tree" {
+		t.Errorf("AppName should be tree, but got %v", got)
+	}
+
+	if got := tree.GetString("db.name"); got != "override" {
+		t.Errorf("db.name should be loaded from the file with higher priority, but got %v", got)
+	}
+
+	if got := tree.GetInt("db.port"); got != 5432 {
+		t.Errorf("db.port should be loaded from env, but got %v", got)
+	}
+
+	if got := tree.GetDuration("timeout"); got != 10*time.Second {
+		t.Errorf("timeout should be 10s, but got %v", got)
+	}
+
+	if got := tree.GetStringSlice("hosts"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("hosts should be [a b], but got %v", got)
+	}
+
+	if got := tree.GetString("contacts[0].email"); got != "admin@example.com" {
+		t.Errorf("contacts[0].email should be admin@example.com, but got %v", got)
+	}
+
+	if tree.IsSet("db.unknown") || !tree.Sub("db").IsSet("name") {
+		t.Errorf("IsSet should report whether values are set")
+	}
+
+	var db struct {
+		Name     string
+		Password string
+		Port     uint
+		PoolSize int `default:"10"`
+	}
+	if err := tree.Sub("DB").Decode(&db); err != nil {
+		t.Errorf("No error should happen when decode db, but got %v", err)
+	}
+
+	if db.Name != "override" || db.Password != "secret" || db.Port != 5432 || db.PoolSize != 10 {
+		t.Errorf("subtree should be decoded with defaults and env, but got %+v", db)
+	}
+}
+
+func TestTreeReload(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("db:\n  name: before\n")
+	file.Close()
+
+	configure := New(&Config{ENVPrefix: "TREE2"})
+	tree, err := configure.LoadTree(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := tree.Sub("db")
+
+	var changed []string
+	configure.OnChange("db", func(event ChangeEvent) {
+		changed = event.Changed
+	})
+
+	ioutil.WriteFile(file.Name(), []byte("db:\n  name: after\n"), 0644)
+	if err := tree.Reload(); err != nil {
+		t.Errorf("No error should happen when reload, but got %v", err)
+	}
+
+	if got := db.GetString("name"); got != "after" {
+		t.Errorf("subtrees should follow reloads, but got %v", got)
+	}
+
+	if !reflect.DeepEqual(changed, []string{"db.name"}) {
+		t.Errorf("reload should notify changed paths, but got %v", changed)
+	}
+}
+
+func TestTreeENVNaming(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "configure.*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("dbConfig:\n  maxConns: 1\n")
+	file.Close()
+
+	os.Setenv("TREE3_DB_CONFIG_MAX_CONNS", "5")
+	defer os.Unsetenv("TREE3_DB_CONFIG_MAX_CONNS")
+
+	tree, err := New(&Config{ENVPrefix: "TREE3", ENVNaming: ScreamingSnakeCase}).LoadTree(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := tree.GetInt("dbConfig.maxConns"); got != 5 {
+		t.Errorf("dbConfig.maxConns should be loaded from env named by ENVNaming, but got %v", got)
+	}
+
+	var db struct {
+		MaxConns int
+	}
+	if err := tree.Sub("dbConfig").Decode(&db); err != nil || db.MaxConns != 5 {
+		t.Errorf("subtree should be decoded with env named by ENVNaming, but got %+v, %v", db, err)
+	}
+}
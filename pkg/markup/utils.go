@@ -21,16 +21,17 @@ package markup
 // THE SOFTWARE.
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
 	"path"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/bhojpur/configure/pkg/toml"
 	"gopkg.in/yaml.v2"
@@ -48,9 +49,19 @@ func (e *UnmatchedTomlKeysError) Error() string {
 	return fmt.Sprintf("There are keys in the config file that do not match any field in the given struct: %v", e.Keys)
 }
 
+// RequiredError is returned when a field tagged with `required:"true"` is
+// blank after loading
+type RequiredError struct {
+	Field string
+}
+
+func (e *RequiredError) Error() string {
+	return e.Field + " is required, but blank"
+}
+
 func (configure *Configure) getENVPrefix(config interface{}) string {
 	if configure.Config.ENVPrefix == "" {
-		if prefix := os.Getenv("CONFIGURE_ENV_PREFIX"); prefix != "" {
+		if prefix := configure.getenv("CONFIGURE_ENV_PREFIX"); prefix != "" {
 			return prefix
 		}
 		return "bhojpur"
@@ -58,7 +69,7 @@ func (configure *Configure) getENVPrefix(config interface{}) string {
 	return configure.Config.ENVPrefix
 }
 
-func getConfigurationFileWithENVPrefix(file, env string) (string, time.Time, error) {
+func (configure *Configure) getConfigurationFileWithENVPrefix(file, env string) (string, time.Time, error) {
 	var (
 		envFile string
 		extname = path.Ext(file)
@@ -70,7 +81,7 @@ func getConfigurationFileWithENVPrefix(file, env string) (string, time.Time, err
 		envFile = fmt.Sprintf("%v.%v%v", strings.TrimSuffix(file, extname), env, extname)
 	}
 
-	if fileInfo, err := os.Stat(envFile); err == nil && fileInfo.Mode().IsRegular() {
+	if fileInfo, err := configure.stat(envFile); err == nil && fileInfo.Mode().IsRegular() {
 		return envFile, fileInfo.ModTime(), nil
 	}
 	return "", time.Now(), fmt.Errorf("failed to find file %v", file)
@@ -80,8 +91,8 @@ func (configure *Configure) getConfigurationFiles(watchMode bool, files ...strin
 	var resultKeys []string
 	var results = map[string]time.Time{}
 
-	if !watchMode && (configure.Config.Debug || configure.Config.Verbose) {
-		fmt.Printf("Current environment: '%v'\n", configure.GetEnvironment())
+	if !watchMode {
+		configure.log(LevelDebug, "Current environment", Fields{"environment": configure.GetEnvironment()})
 	}
 
 	for i := len(files) - 1; i >= 0; i-- {
@@ -89,14 +100,14 @@ func (configure *Configure) getConfigurationFiles(watchMode bool, files ...strin
 		file := files[i]
 
 		// check configuration
-		if fileInfo, err := os.Stat(file); err == nil && fileInfo.Mode().IsRegular() {
+		if fileInfo, err := configure.stat(file); err == nil && fileInfo.Mode().IsRegular() {
 			foundFile = true
 			resultKeys = append(resultKeys, file)
 			results[file] = fileInfo.ModTime()
 		}
 
 		// check configuration with env
-		if file, modTime, err := getConfigurationFileWithENVPrefix(file, configure.GetEnvironment()); err == nil {
+		if file, modTime, err := configure.getConfigurationFileWithENVPrefix(file, configure.GetEnvironment()); err == nil {
 			foundFile = true
 			resultKeys = append(resultKeys, file)
 			results[file] = modTime
@@ -104,64 +115,100 @@ func (configure *Configure) getConfigurationFiles(watchMode bool, files ...strin
 
 		// check example configuration
 		if !foundFile {
-			if example, modTime, err := getConfigurationFileWithENVPrefix(file, "example"); err == nil {
-				if !watchMode && !configure.Silent {
-					fmt.Printf("Failed to find configuration %v, using example file %v\n", file, example)
+			if example, modTime, err := configure.getConfigurationFileWithENVPrefix(file, "example"); err == nil {
+				if !watchMode {
+					configure.log(LevelWarn, "Failed to find configuration, using example file", Fields{"file": file, "example": example})
 				}
 				resultKeys = append(resultKeys, example)
 				results[example] = modTime
-			} else if !configure.Silent {
-				fmt.Printf("Failed to find configuration %v\n", file)
+			} else if !watchMode {
+				configure.log(LevelWarn, "Failed to find configuration", Fields{"file": file})
 			}
 		}
 	}
 	return resultKeys, results
 }
 
-func processFile(config interface{}, file string, errorOnUnmatchedKeys bool) error {
-	data, err := ioutil.ReadFile(file)
+// processFile loads file into config, and records the paths of the values
+// decrypted from envelopes with recorder
+func (configure *Configure) processFile(config interface{}, file string, recorder *sourceRecorder) error {
+	data, err := configure.readFile(file)
 	if err != nil {
 		return err
 	}
 
-	switch {
-	case strings.HasSuffix(file, ".yaml") || strings.HasSuffix(file, ".yml"):
-		if errorOnUnmatchedKeys {
-			return yaml.UnmarshalStrict(data, config)
-		}
-		return yaml.Unmarshal(data, config)
-	case strings.HasSuffix(file, ".toml"):
-		return unmarshalToml(data, config, errorOnUnmatchedKeys)
-	case strings.HasSuffix(file, ".json"):
-		return unmarshalJSON(data, config, errorOnUnmatchedKeys)
-	default:
-		if err := unmarshalToml(data, config, errorOnUnmatchedKeys); err == nil {
-			return nil
-		} else if errUnmatchedKeys, ok := err.(*UnmatchedTomlKeysError); ok {
-			return errUnmatchedKeys
-		}
+	if data, err = configure.renderTemplate(file, data); err != nil {
+		return err
+	}
+	source := data
 
-		if err := unmarshalJSON(data, config, errorOnUnmatchedKeys); err == nil {
-			return nil
-		} else if strings.Contains(err.Error(), "json: unknown field") {
-			return err
-		}
+	if data, err = configure.selectDocuments(config, file, data); err != nil {
+		return err
+	}
 
-		var yamlError error
-		if errorOnUnmatchedKeys {
-			yamlError = yaml.UnmarshalStrict(data, config)
-		} else {
-			yamlError = yaml.Unmarshal(data, config)
-		}
+	var edits []documentEdit
+	if data, edits, err = configure.processDocument(config, file, data); err != nil {
+		return err
+	}
 
-		if yamlError == nil {
-			return nil
-		} else if yErr, ok := yamlError.(*yaml.TypeError); ok {
-			return yErr
+	format, err := decodeFile(config, file, data, configure.GetErrorOnUnmatchedKeys())
+	err = newDecodeError(file, data, format, err)
+
+	// values are decrypted by edits without keys to rename or delete
+	for _, edit := range edits {
+		if edit.rename == "" && !edit.delete {
+			if path, ok := documentFieldPath(reflect.TypeOf(config), edit.keys, format); ok {
+				recorder.encrypted[path] = true
+			}
 		}
+	}
 
-		return errors.New("failed to decode config")
+	// report positions in the file rather than in its rewritten document
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) && decodeErr.File == file && !bytes.Equal(source, data) {
+		configure.relocateDecodeError(decodeErr, source, format, edits)
 	}
+	return err
+}
+
+// decodeFile decodes data of file into config, it returns the format tried
+// last, so that errors can be located in data
+func decodeFile(config interface{}, file string, data []byte, errorOnUnmatchedKeys bool) (string, error) {
+	switch format := getFileFormat(file); format {
+	case FormatYAML:
+		return format, unmarshalYAML(data, config, errorOnUnmatchedKeys)
+	case FormatTOML:
+		return format, unmarshalToml(data, config, errorOnUnmatchedKeys)
+	case FormatJSON:
+		return format, unmarshalJSON(data, config, errorOnUnmatchedKeys)
+	}
+
+	if err := unmarshalToml(data, config, errorOnUnmatchedKeys); err == nil {
+		return FormatTOML, nil
+	} else if errUnmatchedKeys, ok := err.(*UnmatchedTomlKeysError); ok {
+		return FormatTOML, errUnmatchedKeys
+	}
+
+	if err := unmarshalJSON(data, config, errorOnUnmatchedKeys); err == nil {
+		return FormatJSON, nil
+	} else if strings.Contains(err.Error(), "json: unknown field") {
+		return FormatJSON, err
+	}
+
+	if yamlError := unmarshalYAML(data, config, errorOnUnmatchedKeys); yamlError == nil {
+		return FormatYAML, nil
+	} else if yErr, ok := yamlError.(*yaml.TypeError); ok {
+		return FormatYAML, yErr
+	}
+
+	return "", errors.New("failed to decode config")
+}
+
+func unmarshalYAML(data []byte, config interface{}, errorOnUnmatchedKeys bool) error {
+	if errorOnUnmatchedKeys {
+		return yaml.UnmarshalStrict(data, config)
+	}
+	return yaml.Unmarshal(data, config)
 }
 
 // GetStringTomlKeys returns a string array of the names of the keys that are passed in as args
@@ -200,11 +247,145 @@ func unmarshalJSON(data []byte, config interface{}, errorOnUnmatchedKeys bool) e
 	return nil
 }
 
-func getPrefixForStruct(prefixes []string, fieldStruct *reflect.StructField) []string {
-	if fieldStruct.Anonymous && fieldStruct.Tag.Get("anonymous") == "true" {
+// envDisabled starts prefixes of fields tagged with `env:"-"`, whose env
+// variables are not loaded
+const envDisabled = "-"
+
+func isENVDisabled(prefixes []string) bool {
+	return len(prefixes) > 0 && prefixes[0] == envDisabled
+}
+
+// getPrefixForStruct returns the prefixes of env variables of the fields of
+// the struct of fieldStruct. `envprefix` tags replace prefixes, `env:"-"`
+// tags turn env variables off for the struct and structs nested in it
+func (configure *Configure) getPrefixForStruct(prefixes []string, fieldStruct *reflect.StructField) []string {
+	switch {
+	case isENVDisabled(prefixes):
 		return prefixes
+	case fieldStruct.Tag.Get("env") == envDisabled:
+		return []string{envDisabled}
+	case fieldStruct.Tag.Get("envprefix") != "":
+		return []string{strings.TrimSuffix(fieldStruct.Tag.Get("envprefix"), "_")}
+	case fieldStruct.Anonymous && fieldStruct.Tag.Get("anonymous") == "true":
+		return prefixes
+	}
+	return append(prefixes, configure.getENVSegment(fieldStruct.Name))
+}
+
+// getENVSegment returns the segment of env variables for the field name,
+// converted by ENVNaming if it is set
+func (configure *Configure) getENVSegment(name string) string {
+	if configure.Config.ENVNaming != nil {
+		return configure.Config.ENVNaming(name)
+	}
+	return name
+}
+
+// ScreamingSnakeCase converts CamelCase names to SCREAMING_SNAKE_CASE, e.g.
+// `DBPassword` to `DB_PASSWORD`, it could be used as Config.ENVNaming
+func ScreamingSnakeCase(name string) string {
+	var (
+		runes  = []rune(name)
+		result = make([]rune, 0, len(runes)+4)
+	)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				(unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				result = append(result, '_')
+			}
+		}
+		result = append(result, unicode.ToUpper(r))
+	}
+	return string(result)
+}
+
+func (configure *Configure) getENVNames(prefixes []string, fieldStruct *reflect.StructField) []string {
+	envName := fieldStruct.Tag.Get("env")
+	switch {
+	case isENVDisabled(prefixes) || envName == envDisabled:
+		return nil
+	case envName != "":
+		return []string{envName}
+	}
+
+	name := strings.Join(append(prefixes, configure.getENVSegment(fieldStruct.Name)), "_")
+	if upperName := strings.ToUpper(name); upperName == name {
+		return []string{name}
+	}
+	return []string{
+		name,                  // Configure_DB_Name
+		strings.ToUpper(name), // CONFIGURE_DB_NAME
+	}
+}
+
+// hasENVForStruct reports whether env variables are set for any field of
+// struct type t, or of structs nested in it, nested under prefixes
+func (configure *Configure) hasENVForStruct(t reflect.Type, prefixes []string) bool {
+	return configure.hasENVForFields(t, prefixes, map[reflect.Type]bool{})
+}
+
+func (configure *Configure) hasENVForFields(t reflect.Type, prefixes []string, visited map[reflect.Type]bool) bool {
+	if isENVDisabled(prefixes) {
+		return false
+	}
+
+	plan := cachedStructPlan(t)
+	// env variables without the prefix can only target fields with `env` tags
+	if !configure.hasENVPrefix(prefixes) && (len(plan.envTags) == 0 || visited[t]) {
+		return false
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	for _, fieldPlan := range plan.fields {
+		fieldStruct := fieldPlan.fieldStruct
+		envNames := configure.getENVNames(prefixes, &fieldStruct)
+		for _, alias := range fieldPlan.aliases {
+			envNames = append(envNames, configure.getENVNames(prefixes, &reflect.StructField{Name: alias})...)
+		}
+		for _, env := range envNames {
+			if configure.getenv(env) != "" {
+				return true
+			}
+		}
+
+		fieldType := fieldStruct.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		fieldPrefixes := configure.getPrefixForStruct(prefixes, &fieldStruct)
+		if fieldType.Kind() == reflect.Slice {
+			// slices of structs are loaded from env from index 0
+			fieldType, fieldPrefixes = fieldType.Elem(), append(fieldPrefixes, "0")
+			for fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+		}
+
+		if fieldType.Kind() == reflect.Struct && configure.hasENVForFields(fieldType, fieldPrefixes, visited) {
+			return true
+		}
 	}
-	return append(prefixes, fieldStruct.Name)
+	return false
+}
+
+// hasENVPrefix reports whether any env variable is nested under prefixes
+func (configure *Configure) hasENVPrefix(prefixes []string) bool {
+	var (
+		name      = strings.Join(prefixes, "_") + "_"
+		upperName = strings.ToUpper(name)
+	)
+	for _, env := range configure.environ() {
+		if idx := strings.IndexByte(env, '='); idx >= 0 && idx+1 < len(env) {
+			if key := env[:idx]; strings.HasPrefix(key, name) || strings.HasPrefix(key, upperName) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (configure *Configure) processDefaults(config interface{}) error {
@@ -213,24 +394,30 @@ func (configure *Configure) processDefaults(config interface{}) error {
 		return errors.New("invalid config, should be struct")
 	}
 
-	configType := configValue.Type()
-	for i := 0; i < configType.NumField(); i++ {
-		var (
-			fieldStruct = configType.Field(i)
-			field       = configValue.Field(i)
-		)
+	if !configValue.CanAddr() {
+		return nil
+	}
 
-		if !field.CanAddr() || !field.CanInterface() {
-			continue
+	for _, plan := range cachedStructPlan(configValue.Type()).fields {
+		field := configValue.Field(plan.index)
+
+		// Set default configuration if blank
+		if plan.defaultValue != "" && field.IsZero() {
+			if err := yaml.Unmarshal([]byte(plan.defaultValue), field.Addr().Interface()); err != nil {
+				return err
+			}
 		}
 
-		if isBlank := reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()); isBlank {
-			// Set default configuration if blank
-			if value := fieldStruct.Tag.Get("default"); value != "" {
-				if err := yaml.Unmarshal([]byte(value), field.Addr().Interface()); err != nil {
-					return err
-				}
+		// Allocate nil struct pointers only if some of their fields have defaults
+		if plan.structPtr && field.IsNil() {
+			value := reflect.New(field.Type().Elem())
+			if err := configure.processDefaults(value.Interface()); err != nil {
+				return err
 			}
+			if !value.Elem().IsZero() {
+				field.Set(value)
+			}
+			continue
 		}
 
 		for field.Kind() == reflect.Ptr {
@@ -257,40 +444,67 @@ func (configure *Configure) processDefaults(config interface{}) error {
 }
 
 func (configure *Configure) processTags(config interface{}, prefixes ...string) error {
+	var required []string
+	if err := configure.processStructTags(config, prefixes, "", &required); err != nil {
+		return err
+	}
+	return checkRequired(config, required)
+}
+
+// processStructTags loads fields of config at path from env, and appends the
+// paths of fields tagged with `required:"true"` to required, so that they can
+// be checked once every value is loaded. Required fields are not collected
+// if required is nil
+func (configure *Configure) processStructTags(config interface{}, prefixes []string, path string, required *[]string) error {
 	configValue := reflect.Indirect(reflect.ValueOf(config))
 	if configValue.Kind() != reflect.Struct {
 		return errors.New("invalid config, should be struct")
 	}
 
+	if !configValue.CanAddr() {
+		return nil
+	}
+
 	configType := configValue.Type()
-	for i := 0; i < configType.NumField(); i++ {
+	for _, plan := range cachedStructPlan(configType).fields {
 		var (
-			envNames    []string
-			fieldStruct = configType.Field(i)
-			field       = configValue.Field(i)
-			envName     = fieldStruct.Tag.Get("env") // read configuration from shell env
+			fieldStruct = plan.fieldStruct
+			field       = configValue.Field(plan.index)
+			fieldPath   = joinPath(path, fieldStruct.Name)
+			envNames    = configure.getENVNames(prefixes, &fieldStruct) // read configuration from shell env
 		)
 
-		if !field.CanAddr() || !field.CanInterface() {
-			continue
+		if configure.isLogged(LevelTrace) {
+			configure.log(LevelTrace, "Trying to load field from env", Fields{"struct": configType.Name(), "field": fieldStruct.Name, "env": strings.Join(envNames, ", ")})
 		}
 
-		if envName == "" {
-			envNames = append(envNames, strings.Join(append(prefixes, fieldStruct.Name), "_"))                  // Configure_DB_Name
-			envNames = append(envNames, strings.ToUpper(strings.Join(append(prefixes, fieldStruct.Name), "_"))) // CONFIGURE_DB_NAME
-		} else {
-			envNames = []string{envName}
+		// Load From Shell ENV
+		var (
+			aliasNames = map[string]bool{}
+			primaryENV string
+		)
+		if len(envNames) > 0 {
+			primaryENV = envNames[len(envNames)-1]
+		}
+		for _, alias := range plan.aliases {
+			for _, env := range configure.getENVNames(prefixes, &reflect.StructField{Name: alias}) {
+				aliasNames[env] = true
+				envNames = append(envNames, env)
+			}
 		}
 
-		if configure.Config.Verbose {
-			fmt.Printf("Trying to load struct `%v`'s field `%v` from env %v\n", configType.Name(), fieldStruct.Name, strings.Join(envNames, ", "))
+		if configure.Config.StrictENV {
+			configure.recordENVNames(envNames)
 		}
 
-		// Load From Shell ENV
 		for _, env := range envNames {
-			if value := os.Getenv(env); value != "" {
-				if configure.Config.Debug || configure.Config.Verbose {
-					fmt.Printf("Loading configuration for struct `%v`'s field `%v` from env %v...\n", configType.Name(), fieldStruct.Name, env)
+			if value := configure.getenv(env); value != "" {
+				configure.log(LevelDebug, "Loading field from env", Fields{"struct": configType.Name(), "field": fieldStruct.Name, "env": env})
+
+				if aliasNames[env] {
+					configure.warn(Warning{Key: env, Message: fmt.Sprintf("renamed, use %v instead", primaryENV)})
+				} else if plan.deprecated != "" {
+					configure.warn(Warning{Key: env, Message: plan.deprecated})
 				}
 
 				switch reflect.Indirect(field).Kind() {
@@ -312,17 +526,31 @@ func (configure *Configure) processTags(config interface{}, prefixes ...string)
 			}
 		}
 
-		if isBlank := reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()); isBlank && fieldStruct.Tag.Get("required") == "true" {
-			// return error if it is required but blank
-			return errors.New(fieldStruct.Name + " is required, but blank")
+		// Allocate nil struct pointers only if env variables target their fields,
+		// so that unset pointers stay nil. Their required fields are checked
+		// once they are set, like sections loaded from files
+		var allocated bool
+		if plan.structPtr && field.IsNil() && configure.hasENVForStruct(field.Type().Elem(), configure.getPrefixForStruct(prefixes, &fieldStruct)) {
+			value := reflect.New(field.Type().Elem())
+			if err := configure.processStructTags(value.Interface(), configure.getPrefixForStruct(prefixes, &fieldStruct), fieldPath, required); err != nil {
+				return err
+			}
+			if !value.Elem().IsZero() {
+				field.Set(value)
+			}
+			allocated = true
+		}
+
+		if plan.required && required != nil {
+			*required = append(*required, fieldPath)
 		}
 
 		for field.Kind() == reflect.Ptr {
 			field = field.Elem()
 		}
 
-		if field.Kind() == reflect.Struct {
-			if err := configure.processTags(field.Addr().Interface(), getPrefixForStruct(prefixes, &fieldStruct)...); err != nil {
+		if field.Kind() == reflect.Struct && !allocated {
+			if err := configure.processStructTags(field.Addr().Interface(), configure.getPrefixForStruct(prefixes, &fieldStruct), fieldPath, required); err != nil {
 				return err
 			}
 		}
@@ -331,7 +559,7 @@ func (configure *Configure) processTags(config interface{}, prefixes ...string)
 			if arrLen := field.Len(); arrLen > 0 {
 				for i := 0; i < arrLen; i++ {
 					if reflect.Indirect(field.Index(i)).Kind() == reflect.Struct {
-						if err := configure.processTags(field.Index(i).Addr().Interface(), append(getPrefixForStruct(prefixes, &fieldStruct), fmt.Sprint(i))...); err != nil {
+						if err := configure.processStructTags(field.Index(i).Addr().Interface(), append(configure.getPrefixForStruct(prefixes, &fieldStruct), fmt.Sprint(i)), fmt.Sprintf("%v[%v]", fieldPath, i), required); err != nil {
 							return err
 						}
 					}
@@ -345,9 +573,9 @@ func (configure *Configure) processTags(config interface{}, prefixes ...string)
 							idx := 0
 							for {
 								newVal = reflect.New(field.Type().Elem()).Elem()
-								if err := configure.processTags(newVal.Addr().Interface(), append(getPrefixForStruct(prefixes, &fieldStruct), fmt.Sprint(idx))...); err != nil {
+								if err := configure.processStructTags(newVal.Addr().Interface(), append(configure.getPrefixForStruct(prefixes, &fieldStruct), fmt.Sprint(idx)), fmt.Sprintf("%v[%v]", fieldPath, idx), required); err != nil {
 									return // err
-								} else if reflect.DeepEqual(newVal.Interface(), reflect.New(field.Type().Elem()).Elem().Interface()) {
+								} else if newVal.IsZero() {
 									break
 								} else {
 									idx++
@@ -363,14 +591,68 @@ func (configure *Configure) processTags(config interface{}, prefixes ...string)
 	return nil
 }
 
+// checkRequired returns a RequiredError for the first field at paths of
+// config that is blank
+func checkRequired(config interface{}, paths []string) error {
+	for _, path := range paths {
+		if field, ok := lookupPath(reflect.ValueOf(config), path); ok && field.IsZero() {
+			return &RequiredError{Field: path[strings.LastIndex(path, ".")+1:]}
+		}
+	}
+	return nil
+}
+
+// lookupPath returns the field at path of value, e.g. `Contacts[0].Email`,
+// or false if one of its pointers is nil or an index is out of range
+func lookupPath(value reflect.Value, path string) (reflect.Value, bool) {
+	for rest := path; rest != ""; {
+		matches := pathSegmentRegexp.FindStringSubmatch(rest)
+		if matches == nil {
+			return reflect.Value{}, false
+		}
+		rest = rest[len(matches[0]):]
+
+		for value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return reflect.Value{}, false
+			}
+			value = value.Elem()
+		}
+
+		switch {
+		case matches[2] != "":
+			idx, _ := strconv.Atoi(matches[2])
+			if (value.Kind() != reflect.Slice && value.Kind() != reflect.Array) || idx >= value.Len() {
+				return reflect.Value{}, false
+			}
+			value = value.Index(idx)
+		case value.Kind() == reflect.Struct:
+			if value = value.FieldByName(matches[1]); !value.IsValid() {
+				return reflect.Value{}, false
+			}
+		default:
+			return reflect.Value{}, false
+		}
+	}
+	return value, true
+}
+
 func (configure *Configure) load(config interface{}, watchMode bool, files ...string) (err error, changed bool) {
+	var recorder *sourceRecorder
 	defer func() {
-		if configure.Config.Debug || configure.Config.Verbose {
+		if configure.isLogged(LevelDebug) {
 			if err != nil {
-				fmt.Printf("Failed to load configuration from %v, got %v\n", files, err)
+				configure.log(LevelDebug, "Failed to load configuration", Fields{"files": files, "error": err})
+			}
+
+			var encrypted map[string]bool
+			if recorder != nil {
+				encrypted = recorder.encrypted
 			}
 
-			fmt.Printf("Configuration:\n  %#v\n", config)
+			var buffer bytes.Buffer
+			configure.writeDump(&buffer, config, FormatYAML, false, encrypted)
+			configure.log(LevelDebug, "Configuration loaded", Fields{"configuration": buffer.String()})
 		}
 	}()
 
@@ -391,24 +673,61 @@ func (configure *Configure) load(config interface{}, watchMode bool, files ...st
 		}
 	}
 
+	// record where values are loaded from after each step, and the active
+	// files once loaded
+	recorder = newSourceRecorder(config)
+	defer func() {
+		if err == nil {
+			configure.saveSources(recorder)
+
+			configure.mutex.Lock()
+			configure.activeFiles = configFiles
+			configure.mutex.Unlock()
+		}
+	}()
+
 	// process defaults
 	configure.processDefaults(config)
+	recorder.record(SourceDefault)
 
 	for _, file := range configFiles {
-		if configure.Config.Debug || configure.Config.Verbose {
-			fmt.Printf("Loading configurations from file '%v'...\n", file)
-		}
-		if err = processFile(config, file, configure.GetErrorOnUnmatchedKeys()); err != nil {
+		configure.log(LevelDebug, "Loading configuration file", Fields{"file": file})
+		if err = configure.processFile(config, file, recorder); err != nil {
 			return err, true
 		}
+		recorder.record("file:" + file)
 	}
 	configure.configModTimes = configModTimeMap
 
-	if prefix := configure.getENVPrefix(config); prefix == "-" {
-		err = configure.processTags(config)
-	} else {
-		err = configure.processTags(config, prefix)
+	if configure.Config.StrictENV {
+		configure.mutex.Lock()
+		configure.triedENVNames = map[string]bool{}
+		configure.mutex.Unlock()
+	}
+
+	var (
+		prefix   = configure.getENVPrefix(config)
+		prefixes []string
+		required []string
+	)
+	if prefix != "-" {
+		prefixes = []string{prefix}
+	}
+	if err = configure.processStructTags(config, prefixes, "", &required); err != nil {
+		return err, true
 	}
 
-	return err, true
+	if configure.Config.StrictENV {
+		if err = configure.checkUnmatchedENV(prefix); err != nil {
+			return err, true
+		}
+	}
+	recorder.record(SourceENV)
+
+	// set values and overrides may fill required fields, so that they are
+	// checked afterwards
+	if err = configure.applyAssignments(config, recorder); err != nil {
+		return err, true
+	}
+	return checkRequired(config, required), true
 }
@@ -0,0 +1,460 @@
+package markup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/configure/pkg/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// documentNode is a key of a document written with comments, holding either
+// a value, nested fields or a list of nested fields
+type documentNode struct {
+	key      string
+	comments []string
+	value    interface{}
+	fields   []*documentNode
+	items    [][]*documentNode
+	isObject bool
+	isList   bool
+}
+
+// documentBuilder converts a config struct into document nodes
+type documentBuilder struct {
+	format string
+	// comments returns the comments of a field, its path is like `DB.Name`
+	comments func(path string, fieldStruct *reflect.StructField) []string
+	// secret replaces values of fields tagged with `secret:"true"` and values
+	// decrypted from envelopes
+	secret func(value reflect.Value) interface{}
+	// encrypted reports whether the value at path has been decrypted from an
+	// envelope
+	encrypted func(path string) bool
+	// examples, if not nil, expands nil pointers and empty slices of structs
+	// with their default values, set like it loads configurations
+	examples *Configure
+}
+
+func (builder *documentBuilder) build(value reflect.Value, path string) ([]*documentNode, error) {
+	var nodes []*documentNode
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		fieldStruct := value.Type().Field(i)
+		if fieldStruct.PkgPath != "" && !fieldStruct.Anonymous {
+			continue
+		}
+
+		key, inline := documentKey(&fieldStruct, builder.format)
+		if key == "-" {
+			continue
+		}
+
+		field, err := builder.getFieldValue(value.Field(i))
+		if err != nil {
+			return nil, err
+		}
+
+		if inline {
+			if field.IsValid() && field.Kind() == reflect.Struct {
+				fields, err := builder.build(field, joinPath(path, fieldStruct.Name))
+				if err != nil {
+					return nil, err
+				}
+				nodes = append(nodes, fields...)
+			}
+			continue
+		}
+
+		fieldPath := joinPath(path, fieldStruct.Name)
+		node := &documentNode{key: key}
+		if builder.comments != nil {
+			node.comments = builder.comments(fieldPath, &fieldStruct)
+		}
+
+		switch {
+		case !field.IsValid():
+			continue
+		case fieldStruct.Tag.Get("secret") == "true" && builder.secret != nil:
+			node.value = builder.secret(field)
+		default:
+			if err := builder.buildValue(node, field, fieldPath); err != nil {
+				return nil, err
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// buildValue sets the value of node to value, or its nested fields, so that
+// fields of structs nested in lists and maps are written like other fields
+func (builder *documentBuilder) buildValue(node *documentNode, value reflect.Value, path string) (err error) {
+	switch {
+	case isNestedStruct(value.Type()):
+		node.isObject = true
+		node.fields, err = builder.build(value, path)
+	case (value.Kind() == reflect.Slice || value.Kind() == reflect.Array) && isNestedStruct(indirectType(value.Type().Elem())):
+		node.isList = true
+		for idx := 0; idx < value.Len(); idx++ {
+			elem, err := builder.getFieldValue(value.Index(idx))
+			if err != nil {
+				return err
+			}
+
+			if elem.IsValid() {
+				item, err := builder.build(elem, fmt.Sprintf("%v[%v]", path, idx))
+				if err != nil {
+					return err
+				}
+				node.items = append(node.items, item)
+			}
+		}
+		if value.Len() == 0 && builder.examples != nil {
+			elem := reflect.New(indirectType(value.Type().Elem()))
+			if err := builder.examples.processDefaults(elem.Interface()); err != nil {
+				return err
+			}
+
+			item, err := builder.build(elem.Elem(), path+"[0]")
+			if err != nil {
+				return err
+			}
+			node.items = append(node.items, item)
+		}
+	case value.Kind() == reflect.Map && value.Type().Key().Kind() == reflect.String:
+		node.isObject = true
+		keys := value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, mapKey := range keys {
+			elem := value.MapIndex(mapKey)
+			for elem.Kind() == reflect.Interface && !elem.IsNil() {
+				elem = elem.Elem()
+			}
+
+			child := &documentNode{key: mapKey.String()}
+			if elem, err = builder.getFieldValue(elem); err != nil {
+				return err
+			}
+
+			if elem.IsValid() && elem.Kind() != reflect.Interface {
+				if err := builder.buildValue(child, elem, joinPath(path, mapKey.String())); err != nil {
+					return err
+				}
+			}
+			node.fields = append(node.fields, child)
+		}
+	case builder.secret != nil && builder.encrypted != nil && builder.encrypted(path):
+		node.value = builder.secret(value)
+	default:
+		node.value = builder.getValue(value)
+	}
+	return err
+}
+
+// getFieldValue dereferences pointers of field, allocating nil struct
+// pointers with their default values in examples
+func (builder *documentBuilder) getFieldValue(field reflect.Value) (reflect.Value, error) {
+	for field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			if builder.examples == nil || !isNestedStruct(indirectType(field.Type())) {
+				return reflect.Value{}, nil
+			}
+			value := reflect.New(indirectType(field.Type()))
+			if err := builder.examples.processDefaults(value.Interface()); err != nil {
+				return reflect.Value{}, err
+			}
+			return value.Elem(), nil
+		}
+		field = field.Elem()
+	}
+	return field, nil
+}
+
+// getValue returns the value to write for a scalar field, values holding
+// secret fields the builder can't nest are replaced as a whole
+func (builder *documentBuilder) getValue(value reflect.Value) interface{} {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	if builder.secret != nil && hasSecretFields(value.Type()) {
+		return builder.secret(value)
+	}
+
+	// only yaml decodes durations from strings
+	if value.Type() == durationType && builder.format == FormatYAML {
+		return value.Interface().(time.Duration).String()
+	}
+	return value.Interface()
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// hasSecretFields reports whether t holds fields tagged with
+// `secret:"true"`, in structs, lists or maps
+func hasSecretFields(t reflect.Type) bool {
+	return findSecretFields(t, map[reflect.Type]bool{})
+}
+
+func findSecretFields(t reflect.Type, visited map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct || visited[t] {
+		return false
+	}
+	visited[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		fieldStruct := t.Field(i)
+		if fieldStruct.Tag.Get("secret") == "true" || findSecretFields(fieldStruct.Type, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNestedStruct reports whether t is a struct written as nested fields
+func isNestedStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// writeDocument writes nodes to w in format, with their comments if the
+// format supports comments
+func writeDocument(w io.Writer, nodes []*documentNode, format string) error {
+	var (
+		buffer bytes.Buffer
+		err    error
+	)
+
+	switch format {
+	case FormatYAML:
+		err = writeYAMLNodes(&buffer, nodes, "")
+	case FormatTOML:
+		err = writeTOMLNodes(&buffer, nodes, nil)
+	case FormatJSON:
+		if err = writeJSONNodes(&buffer, nodes, ""); err == nil {
+			buffer.WriteString("\n")
+		}
+	default:
+		err = fmt.Errorf("unsupported format %v", format)
+	}
+
+	if err == nil {
+		_, err = w.Write(buffer.Bytes())
+	}
+	return err
+}
+
+func writeComments(buffer *bytes.Buffer, comments []string, indent string) {
+	for _, comment := range comments {
+		for _, line := range strings.Split(comment, "\n") {
+			fmt.Fprintf(buffer, "%v# %v\n", indent, line)
+		}
+	}
+}
+
+func writeYAMLNodes(buffer *bytes.Buffer, nodes []*documentNode, indent string) error {
+	for _, node := range nodes {
+		writeComments(buffer, node.comments, indent)
+
+		key, err := yaml.Marshal(node.key)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buffer, "%v%v:", indent, strings.TrimSuffix(string(key), "\n"))
+
+		switch {
+		case node.isObject && len(node.fields) == 0:
+			buffer.WriteString(" {}\n")
+		case node.isObject:
+			buffer.WriteString("\n")
+			if err := writeYAMLNodes(buffer, node.fields, indent+"  "); err != nil {
+				return err
+			}
+		case node.isList && len(node.items) == 0:
+			buffer.WriteString(" []\n")
+		case node.isList:
+			buffer.WriteString("\n")
+			for _, item := range node.items {
+				var itemBuffer bytes.Buffer
+				if err := writeYAMLNodes(&itemBuffer, item, indent+"    "); err != nil {
+					return err
+				}
+				// replace the indent of the first key with the item marker, and
+				// align its comments with the marker
+				lines := strings.SplitAfter(itemBuffer.String(), "\n")
+				for i, line := range lines {
+					if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+						lines[i] = indent + "  - " + strings.TrimPrefix(line, indent+"    ")
+						break
+					}
+					lines[i] = indent + "  " + strings.TrimPrefix(line, indent+"    ")
+				}
+				buffer.WriteString(strings.Join(lines, ""))
+			}
+		default:
+			value, err := yaml.Marshal(node.value)
+			if err != nil {
+				return err
+			}
+
+			if lines := strings.Split(strings.TrimSuffix(string(value), "\n"), "\n"); len(lines) == 1 {
+				fmt.Fprintf(buffer, " %v\n", lines[0])
+			} else {
+				buffer.WriteString("\n")
+				for _, line := range lines {
+					fmt.Fprintf(buffer, "%v  %v\n", indent, line)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+var bareTOMLKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func getTOMLKey(key string) string {
+	if bareTOMLKeyRegexp.MatchString(key) {
+		return key
+	}
+	value, _ := json.Marshal(key)
+	return string(value)
+}
+
+func getTOMLTableName(keys []string) string {
+	var names []string
+	for _, key := range keys {
+		names = append(names, getTOMLKey(key))
+	}
+	return strings.Join(names, ".")
+}
+
+func writeTOMLNodes(buffer *bytes.Buffer, nodes []*documentNode, keys []string) error {
+	// values should be written before tables
+	for _, node := range nodes {
+		if node.isObject || node.isList || node.value == nil {
+			continue
+		}
+
+		var value bytes.Buffer
+		if err := toml.NewEncoder(&value).Encode(map[string]interface{}{"v": node.value}); err != nil {
+			return err
+		}
+
+		writeComments(buffer, node.comments, "")
+		fmt.Fprintf(buffer, "%v = %v\n", getTOMLKey(node.key), strings.TrimSpace(strings.TrimPrefix(value.String(), "v = ")))
+	}
+
+	for _, node := range nodes {
+		tableKeys := append(append([]string{}, keys...), node.key)
+		switch {
+		case node.isObject:
+			buffer.WriteString("\n")
+			writeComments(buffer, node.comments, "")
+			fmt.Fprintf(buffer, "[%v]\n", getTOMLTableName(tableKeys))
+			if err := writeTOMLNodes(buffer, node.fields, tableKeys); err != nil {
+				return err
+			}
+		case node.isList:
+			for _, item := range node.items {
+				buffer.WriteString("\n")
+				writeComments(buffer, node.comments, "")
+				fmt.Fprintf(buffer, "[[%v]]\n", getTOMLTableName(tableKeys))
+				if err := writeTOMLNodes(buffer, item, tableKeys); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func writeJSONNodes(buffer *bytes.Buffer, nodes []*documentNode, indent string) error {
+	buffer.WriteString("{")
+	for i, node := range nodes {
+		if i > 0 {
+			buffer.WriteString(",")
+		}
+
+		key, _ := json.Marshal(node.key)
+		fmt.Fprintf(buffer, "\n%v  %s: ", indent, key)
+
+		switch {
+		case node.isObject:
+			if err := writeJSONNodes(buffer, node.fields, indent+"  "); err != nil {
+				return err
+			}
+		case node.isList:
+			buffer.WriteString("[")
+			for j, item := range node.items {
+				if j > 0 {
+					buffer.WriteString(",")
+				}
+				fmt.Fprintf(buffer, "\n%v    ", indent)
+				if err := writeJSONNodes(buffer, item, indent+"    "); err != nil {
+					return err
+				}
+			}
+			if len(node.items) > 0 {
+				fmt.Fprintf(buffer, "\n%v  ", indent)
+			}
+			buffer.WriteString("]")
+		default:
+			var value bytes.Buffer
+			encoder := json.NewEncoder(&value)
+			encoder.SetEscapeHTML(false)
+			encoder.SetIndent(indent+"  ", "  ")
+			if err := encoder.Encode(node.value); err != nil {
+				return err
+			}
+			buffer.Write(bytes.TrimSuffix(value.Bytes(), []byte("\n")))
+		}
+	}
+
+	if len(nodes) > 0 {
+		fmt.Fprintf(buffer, "\n%v", indent)
+	}
+	buffer.WriteString("}")
+	return nil
+}